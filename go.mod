@@ -2,6 +2,7 @@ module github.com/029614/gcode_lang
 
 go 1.22.3
 
-require github.com/Anaxarchus/zero-gdscript v0.3.0
-
-require github.com/ctessum/go.clipper v0.1.2 // indirect
+require (
+	github.com/Anaxarchus/zero-gdscript v0.3.0
+	github.com/ctessum/go.clipper v0.1.2
+)
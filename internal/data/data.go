@@ -10,6 +10,7 @@ type Data struct {
 	ToolLibrary      *ToolLibrary
 	OperationLibrary *OperationLibrary
 	RouterLibrary    *RouterLibrary
+	MaterialLibrary  *MaterialLibrary
 }
 
 func NewData() *Data {
@@ -17,6 +18,7 @@ func NewData() *Data {
 		ToolLibrary:      GetToolLibrary(),
 		OperationLibrary: GetOperationsLibrary(),
 		RouterLibrary:    GetRouterLibrary(),
+		MaterialLibrary:  GetMaterialLibrary(),
 	}
 }
 
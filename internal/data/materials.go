@@ -0,0 +1,71 @@
+package data
+
+import (
+	"errors"
+)
+
+type MaterialLibrary []*Material
+
+type MaterialSize struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	Z float64 `json:"z"`
+}
+
+type Material struct {
+	ID         string       `json:"id"`
+	Vendors    []string     `json:"vendors"`
+	Size       MaterialSize `json:"size"`
+	Core       string       `json:"core"`
+	Face1      string       `json:"face1"`
+	Face2      string       `json:"face2"`
+	FinishName string       `json:"finish_name"`
+	FinishID   string       `json:"finish_id"`
+	Brand      string       `json:"brand"`
+
+	// OnionSkin is the thickness left above the spoilboard when small parts are onion skinned.
+	// Zero disables onion skinning for the material.
+	OnionSkin float64 `json:"onion_skin,omitempty"`
+	// HoldingSkin is the thinnest skin left above the spoilboard that still holds a part down. Cuts
+	// leaving less cut parts loose. Zero takes every closed cut to cut its part loose.
+	HoldingSkin float64 `json:"holding_skin,omitempty"`
+}
+
+func (ml *MaterialLibrary) GetMaterialByID(id string) (*Material, error) {
+	for _, material := range *ml {
+		if material.ID == id {
+			return material, nil
+		}
+	}
+	return nil, errors.New("Material not found")
+}
+
+func (ml *MaterialLibrary) GetMaterialByName(name string) (*Material, error) {
+	for _, material := range *ml {
+		if material.FinishName == name {
+			return material, nil
+		}
+	}
+	return nil, errors.New("Material not found")
+}
+
+func (ml *MaterialLibrary) ListMaterialsByName() []string {
+	var materialList []string
+	for _, material := range *ml {
+		materialList = append(materialList, material.FinishName)
+	}
+	return materialList
+}
+
+// Thickness returns the thickness of the sheet stock.
+func (m *Material) Thickness() float64 {
+	return m.Size.Z
+}
+
+// GetMaterialLibrary loads the MaterialLibrary from the specified mock file.
+func GetMaterialLibrary() *MaterialLibrary {
+	filePath := "./tests/resources/materials.json"
+	var materialLibrary MaterialLibrary
+	unmarshalJson(filePath, &materialLibrary)
+	return &materialLibrary
+}
@@ -18,6 +18,106 @@ type Operation struct {
 	CutDepth   float64 `json:"cut_depth"`
 	CutHeight  float64 `json:"cut_height"`
 	FeedHeight float64 `json:"feed_height"`
+
+	// ZReference is what the heights and depths of the operation are measured from, "table" for the
+	// table surface or "top" for the top of the material, below which they are negative. Empty is "table".
+	ZReference string `json:"z_reference,omitempty"`
+
+	// Direction is the cut direction, "climb" or "conventional". Empty climbs.
+	Direction string `json:"direction,omitempty"`
+	// MaxPassDepth limits the depth of each pass. Zero defers to the tool.
+	MaxPassDepth float64 `json:"max_pass_depth,omitempty"`
+	// FinishPassDepth leaves a lighter final pass of this depth. Zero disables it.
+	FinishPassDepth float64 `json:"finish_pass_depth,omitempty"`
+	// FinishAllowance is the stock the passes of a compensated cut leave on the wall, taken off by a
+	// final full depth pass at the true offset. Zero disables it.
+	FinishAllowance float64 `json:"finish_allowance,omitempty"`
+	// FinishFeedRate is the feed rate of the finish passes. Zero uses FeedRate.
+	FinishFeedRate int `json:"finish_feed_rate,omitempty"`
+	// Strategy is the clearing strategy, "offset", "raster" or "adaptive".
+	Strategy string `json:"strategy,omitempty"`
+	// Stepover is the distance between pocket passes, as a percentage of the tool's cut diameter.
+	Stepover float64 `json:"stepover,omitempty"`
+	// CutAngle is the direction of raster passes, in degrees from the X axis.
+	CutAngle float64 `json:"cut_angle,omitempty"`
+	// MaxEngagement limits the angle, in degrees, the tool wraps into the material when clearing adaptively.
+	MaxEngagement float64 `json:"max_engagement,omitempty"`
+	// SlotWidth is the width of an adaptively cleared slot along a chain. Zero is the tool's cut diameter.
+	SlotWidth float64 `json:"slot_width,omitempty"`
+	// CleanupTool is the id of a smaller tool that removes the material Tool leaves in the corners.
+	CleanupTool string `json:"cleanup_tool,omitempty"`
+	// LeadIn and LeadOut shape the moves onto and off closed contours: "arc", "line", "ramp" or none.
+	LeadIn  string `json:"lead_in,omitempty"`
+	LeadOut string `json:"lead_out,omitempty"`
+	// LeadLength is the radius of arc leads and the length of line and ramp leads.
+	LeadLength float64 `json:"lead_length,omitempty"`
+	// Overlap is the distance a closed contour is cut past its start.
+	Overlap float64 `json:"overlap,omitempty"`
+	// StartPoint picks where closed contours start: "longest", "corner", "point", or their first point.
+	StartPoint string `json:"start_point,omitempty"`
+	// StartPosition is the point, in part coordinates, contours start nearest when StartPoint is "point".
+	StartPosition [2]float64 `json:"start_position,omitempty"`
+	// CornerRelief relieves the inside corners of cuts and pockets: "dogbone", "tbone" or none. Centre
+	// line cuts relieve the outside of every turn, where both walls of the slot are cut.
+	CornerRelief string `json:"corner_relief,omitempty"`
+	// ReliefAngle is the largest interior angle, in degrees, of a relieved corner. Zero is DefaultReliefAngle.
+	ReliefAngle float64 `json:"relief_angle,omitempty"`
+	// EndCap finishes the ends of compensated open chains: "square" or "round" carry the cut on past
+	// them by the tool radius, "butt" or empty stops in line with them.
+	EndCap string `json:"end_cap,omitempty"`
+	// DrillDepth is the Z drill operations drill down to. Negative depths are measured down from DrillHeight.
+	DrillDepth float64 `json:"drill_depth,omitempty"`
+	// DrillHeight is the Z drill operations start drilling from, the top of the material.
+	DrillHeight float64 `json:"drill_height,omitempty"`
+	// PeckDepth is the depth drilled between retracts to clear chips. Zero drills each hole in one go.
+	PeckDepth float64 `json:"peck_depth,omitempty"`
+	// PeckRetract is how far the drill backs off between pecks. Zero retracts to DrillHeight.
+	PeckRetract float64 `json:"peck_retract,omitempty"`
+	// HelixPitch is the depth descended each turn when boring holes wider than the tool. Zero is DefaultHelixPitch.
+	HelixPitch float64 `json:"helix_pitch,omitempty"`
+	// Feeds is "auto" to calculate FeedRate, PlungeRate and SpindleRPM from the chipload of the tool in the material.
+	Feeds string `json:"feeds,omitempty"`
+	// FeedReduction slows the feed on tight arcs, sharp corners and small parts. Nil, like each of its
+	// zero values, doesn't slow the feed.
+	FeedReduction *FeedReduction `json:"feed_reduction,omitempty"`
+	// Tabs holds the holding tab rules of the operation, keyed by part category ("tiny", "small", ...).
+	Tabs map[string]TabRule `json:"tabs,omitempty"`
+}
+
+// TabRule describes the holding tabs left on a through cut.
+type TabRule struct {
+	Count  int     `json:"count"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// FeedCurve maps a measure to the fraction of the feed rate cut at, interpolating between its
+// points, which run in increasing order of measure. Beyond its ends the nearest point holds.
+type FeedCurve [][2]float64
+
+// FeedReduction describes how far the feed rate is slowed where the tool burns or chatters at full feed.
+type FeedReduction struct {
+	Radius FeedCurve `json:"radius,omitempty"` // by the radius of the arc the tool centre follows
+	Corner FeedCurve `json:"corner,omitempty"` // by the angle, in degrees, the tool turns at a corner
+	Small  float64   `json:"small,omitempty"`  // on parts of the small category, zero being full feed
+	Tiny   float64   `json:"tiny,omitempty"`   // on parts of the tiny category, zero being full feed
+}
+
+// At returns the fraction of the feed rate the curve gives at the measure, or 1 if the curve is empty.
+func (fc FeedCurve) At(x float64) float64 {
+	if len(fc) == 0 {
+		return 1
+	}
+	if x <= fc[0][0] {
+		return fc[0][1]
+	}
+	for i := 1; i < len(fc); i++ {
+		if x <= fc[i][0] {
+			t := (x - fc[i-1][0]) / (fc[i][0] - fc[i-1][0])
+			return fc[i-1][1] + (fc[i][1]-fc[i-1][1])*t
+		}
+	}
+	return fc[len(fc)-1][1]
 }
 
 func (ol *OperationLibrary) GetOperationByName(name string) (*Operation, error) {
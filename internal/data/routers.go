@@ -6,11 +6,31 @@ import (
 
 type RouterLibrary []*Router
 
+const SpindleSlotCount = 12
+const GangSlotCount = 9
+
 type Router struct {
 	ID      string            `json:"id"`
 	Name    string            `json:"name"`
 	Spindle RouterSpindleData `json:"spindle"`
 	Gang    RouterGangData    `json:"gangdrill"`
+
+	// ZZero is where the machine's Z zero is set, "table" for the table surface or "top" for the top
+	// of the material. Empty is "table".
+	ZZero string `json:"z_zero,omitempty"`
+	// ZNegativeUp is set on machines whose Z axis is negative upwards.
+	ZNegativeUp bool `json:"z_negative_up,omitempty"`
+	// SpoilboardPenetration is the deepest the machine may cut below the table surface into the
+	// spoilboard. Zero allows no cut below the table.
+	SpoilboardPenetration float64 `json:"spoilboard_penetration,omitempty"`
+	// RapidClearance is the height above the material the tool travels at between features when the
+	// way doesn't cross anything already cut free. Zero always travels at the operation's FeedHeight.
+	RapidClearance float64 `json:"rapid_clearance,omitempty"`
+	// ActiveSlot is the spindle slot whose tool is in the spindle when a program starts. Zero is unknown.
+	ActiveSlot int `json:"active_slot,omitempty"`
+	// Subprograms writes the parts that cut alike once, as a subprogram called for each of them.
+	// The controller must take G52 local origins and G68 rotations.
+	Subprograms bool `json:"subprograms,omitempty"`
 }
 
 type SlotData string
@@ -104,6 +124,21 @@ func (r *Router) GetSpindleSlot(idx int) SlotData {
 	}
 }
 
+// FindSpindleSlot returns the spindle slot holding the tool, or 0 if it isn't loaded.
+func (r *Router) FindSpindleSlot(toolID string) int {
+	for idx := 1; idx <= SpindleSlotCount; idx++ {
+		if toolID != "" && string(r.GetSpindleSlot(idx)) == toolID {
+			return idx
+		}
+	}
+	return 0
+}
+
+// ActiveTool returns the id of the tool in the spindle when a program starts, or "" if it isn't known.
+func (r *Router) ActiveTool() string {
+	return string(r.GetSpindleSlot(r.ActiveSlot))
+}
+
 func (r *Router) GetGangSlot(idx int) GangSlotData {
 	switch idx {
 	case 1:
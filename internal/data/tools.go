@@ -20,6 +20,7 @@ type Tool struct {
 	Meta          map[string]interface{} `json:"meta"`
 	Supplier      string                 `json:"supplier"`
 	Model         string                 `json:"model"`
+	MaxPassDepth  float64                `json:"max_pass_depth,omitempty"`
 }
 
 func (tl *ToolLibrary) GetToolByID(id string) (*Tool, error) {
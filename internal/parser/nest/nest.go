@@ -3,6 +3,7 @@ package nestparser
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -71,6 +72,14 @@ type Operation struct {
 	Geometry  BaseGeometry `json:"geometry"`
 	Operation string       `json:"operation"`
 	Depth     float64      `json:"depth"`
+	Part      *Part        `json:"-"` // the part the geometry belongs to, set while toolpathing
+}
+
+// Tab is a holding tab on the part's through cut, in part coordinates.
+type Tab struct {
+	Position Vector2 `json:"position"`
+	Width    float64 `json:"width"`
+	Height   float64 `json:"height"`
 }
 
 type PartGeometry struct {
@@ -95,6 +104,7 @@ type Part struct {
 	Quantity   int          `json:"quantity,omitempty"`
 	UnitLetter string       `json:"unitLetter,omitempty"`
 	Geometry   PartGeometry `json:"geometry,omitempty"`
+	Tabs       []Tab        `json:"tabs,omitempty"` // overrides the automatically placed tabs
 }
 
 type Sheet struct {
@@ -150,6 +160,10 @@ func (pl *PartList) LoadNest(filepath string) error {
 				originalPart.SheetNumber = sheet.SheetNumber
 				originalPart.Origin = fragment.Origin
 				originalPart.IsRotated = fragment.IsRotated
+				if len(fragment.Tabs) > 0 {
+					// tabs edited in the nest override the part's own
+					originalPart.Tabs = fragment.Tabs
+				}
 				// Update any other properties as needed
 			} else {
 				// Log if the original part is not found
@@ -298,3 +312,52 @@ func GetOperationSliceBoundingBox(ops []*Operation) Rect2 {
 
 	return res
 }
+
+// Place moves a point of the part's geometry to its position on the sheet. Rotated parts are turned
+// a quarter counter-clockwise, keeping them within their placed bounds.
+func (p *Part) Place(point Vector2) Vector2 {
+	if p.IsRotated == 1 {
+		point = vector2.New(p.Size.Y-point.Y, point.X)
+	}
+	return point.Add(p.Origin)
+}
+
+// Placed returns a copy of the part with its geometry and tabs moved to its position on the sheet.
+func (p *Part) Placed() *Part {
+	placed := *p
+	placed.Geometry = PartGeometry{
+		Points: p.placeOperations(p.Geometry.Points),
+		Chains: p.placeOperations(p.Geometry.Chains),
+		Arcs:   p.placeOperations(p.Geometry.Arcs),
+	}
+	placed.Tabs = make([]Tab, len(p.Tabs))
+	for i, tab := range p.Tabs {
+		tab.Position = p.Place(tab.Position)
+		placed.Tabs[i] = tab
+	}
+	return &placed
+}
+
+func (p *Part) placeOperations(ops []Operation) []Operation {
+	res := make([]Operation, len(ops))
+	for i, op := range ops {
+		switch g := op.Geometry.(type) {
+		case ChainGeometry:
+			points := make([]Point, len(g.Points))
+			for j, pt := range g.Points {
+				pt.Vector2 = p.Place(pt.Vector2)
+				points[j] = pt
+			}
+			g.Points = points
+			op.Geometry = g
+		case ArcGeometry:
+			g.Position.Vector2 = p.Place(g.Position.Vector2)
+			if p.IsRotated == 1 {
+				g.StartAngle += math.Pi * 0.5
+			}
+			op.Geometry = g
+		}
+		res[i] = op
+	}
+	return res
+}
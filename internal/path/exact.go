@@ -0,0 +1,230 @@
+package path
+
+import (
+	"math"
+
+	"github.com/Anaxarchus/zero-gdscript/pkg/vector2"
+)
+
+// EndCap shapes the ends of an offset open path.
+type EndCap int
+
+const (
+	// EndCapButt stops the offset in line with the ends of the path.
+	EndCapButt EndCap = iota
+	// EndCapSquare carries the offset straight on past the ends of the path by the offset distance.
+	EndCapSquare
+	// EndCapRound carries the offset around the ends of the path, finishing in line with it.
+	EndCapRound
+)
+
+// offset shifts the segment by delta to the right of its direction of travel. Arcs keep their center
+// and sweep. It reports false if an arc shrinks away to nothing.
+func (s Segment) offset(delta float64) (Segment, bool) {
+	if !s.isArc() {
+		dir := s.Start.DirectionTo(s.End)
+		n := vector2.New(dir.Y, -dir.X).Mulf(delta)
+		return NewLine(s.Start.Add(n), s.End.Add(n)), true
+	}
+	// the right of a counter-clockwise arc is outside it
+	r := s.Radius()
+	nr := r - delta
+	if s.Sweep > 0 {
+		nr = r + delta
+	}
+	if nr < segmentTolerance {
+		return Segment{}, false
+	}
+	scale := nr / r
+	return Segment{
+		Kind:   SegmentArc,
+		Start:  s.Center.Add(s.Start.Sub(s.Center).Mulf(scale)),
+		End:    s.Center.Add(s.End.Sub(s.Center).Mulf(scale)),
+		Center: s.Center,
+		Sweep:  s.Sweep,
+	}, true
+}
+
+// sweepTo returns the sweep from the start of the arc to pt, in the arc's direction.
+func (s Segment) sweepTo(pt vector2.Vector2) float64 {
+	a := s.Start.Sub(s.Center).AngleTo(pt.Sub(s.Center))
+	if s.Sweep > 0 && a < 0 {
+		a += 2 * math.Pi
+	} else if s.Sweep < 0 && a > 0 {
+		a -= 2 * math.Pi
+	}
+	return a
+}
+
+// withEnd cuts the segment short at pt. It reports false if pt isn't on the way from its start to its end.
+func (s Segment) withEnd(pt vector2.Vector2) (Segment, bool) {
+	if !s.isArc() {
+		dir := s.Start.DirectionTo(s.End)
+		along := pt.Sub(s.Start).Dot(dir)
+		return NewLine(s.Start, pt), along > segmentTolerance && along <= s.Start.DistanceTo(s.End)+segmentTolerance
+	}
+	sweep := s.sweepTo(pt)
+	return Segment{Kind: SegmentArc, Start: s.Start, End: pt, Center: s.Center, Sweep: sweep},
+		math.Abs(sweep) > segmentTolerance && math.Abs(sweep) <= math.Abs(s.Sweep)+segmentTolerance
+}
+
+// withStart cuts the segment short so it starts at pt. It reports false if pt isn't on the way from
+// its start to its end.
+func (s Segment) withStart(pt vector2.Vector2) (Segment, bool) {
+	rev, ok := s.Reversed().withEnd(pt)
+	return rev.Reversed(), ok
+}
+
+// intersections returns the points where the line or circle the segment lies on meets the one o lies on.
+func (s Segment) intersections(o Segment) []vector2.Vector2 {
+	switch {
+	case !s.isArc() && !o.isArc():
+		return lineLineIntersections(s.Start, s.End, o.Start, o.End)
+	case !s.isArc():
+		return lineCircleIntersections(s.Start, s.End, o.Center, o.Radius())
+	case !o.isArc():
+		return lineCircleIntersections(o.Start, o.End, s.Center, s.Radius())
+	default:
+		return circleCircleIntersections(s.Center, s.Radius(), o.Center, o.Radius())
+	}
+}
+
+func lineLineIntersections(a1, a2, b1, b2 vector2.Vector2) []vector2.Vector2 {
+	da, db := a2.Sub(a1), b2.Sub(b1)
+	denom := da.Cross(db)
+	if math.Abs(denom) < 1e-12 {
+		return nil
+	}
+	t := b1.Sub(a1).Cross(db) / denom
+	return []vector2.Vector2{a1.Add(da.Mulf(t))}
+}
+
+func lineCircleIntersections(a1, a2, center vector2.Vector2, radius float64) []vector2.Vector2 {
+	dir := a1.DirectionTo(a2)
+	foot := a1.Add(dir.Mulf(center.Sub(a1).Dot(dir)))
+	h2 := radius*radius - foot.DistanceSquaredTo(center)
+	if h2 < -segmentTolerance {
+		return nil
+	}
+	h := math.Sqrt(math.Max(h2, 0))
+	return []vector2.Vector2{foot.Sub(dir.Mulf(h)), foot.Add(dir.Mulf(h))}
+}
+
+func circleCircleIntersections(c1 vector2.Vector2, r1 float64, c2 vector2.Vector2, r2 float64) []vector2.Vector2 {
+	d := c1.DistanceTo(c2)
+	if d < segmentTolerance || d > r1+r2+segmentTolerance || d < math.Abs(r1-r2)-segmentTolerance {
+		return nil
+	}
+	a := (r1*r1 - r2*r2 + d*d) / (2 * d)
+	h := math.Sqrt(math.Max(r1*r1-a*a, 0))
+	dir := c1.DirectionTo(c2)
+	mid := c1.Add(dir.Mulf(a))
+	n := vector2.New(-dir.Y, dir.X).Mulf(h)
+	return []vector2.Vector2{mid.Add(n), mid.Sub(n)}
+}
+
+// offsetSegments offsets the segments by delta to the right of their direction of travel, keeping
+// arcs true arcs. The offset segments are trimmed where they overlap inside corners and joined where
+// they part around outside ones, with arcs around the corner when round is set and with miters, up to
+// MiterLimit, otherwise. It reports false when the offset can't be made exactly, as when an arc
+// shrinks away or a segment is trimmed away entirely.
+func offsetSegments(segs []Segment, delta float64, closed, round bool) ([]Segment, bool) {
+	if len(segs) == 0 {
+		return nil, false
+	}
+	offset := make([]Segment, len(segs))
+	for i, s := range segs {
+		o, ok := s.offset(delta)
+		if !ok {
+			return nil, false
+		}
+		offset[i] = o
+	}
+
+	joins := make([][]Segment, len(segs))
+	count := len(segs) - 1
+	if closed {
+		count = len(segs)
+	}
+	for i := 0; i < count; i++ {
+		j := (i + 1) % len(segs)
+		a, b, join, ok := joinSegments(offset[i], offset[j], segs[i].End, segs[i].tangent(segs[i].End), segs[j].tangent(segs[j].Start), delta, round)
+		if !ok {
+			return nil, false
+		}
+		offset[i], offset[j], joins[i] = a, b, join
+	}
+
+	var res []Segment
+	for i := range offset {
+		res = append(res, offset[i])
+		res = append(res, joins[i]...)
+	}
+	return res, true
+}
+
+// joinSegments joins a to the b that follows it at the vertex of the path they were offset from,
+// where the path turns from direction ta to tb.
+func joinSegments(a, b Segment, vertex, ta, tb vector2.Vector2, delta float64, round bool) (Segment, Segment, []Segment, bool) {
+	if a.End.DistanceTo(b.Start) <= segmentTolerance {
+		b.Start = a.End
+		return a, b, nil, true
+	}
+
+	turn := ta.Cross(tb)
+	if turn*delta > 0 || (math.Abs(turn) < 1e-9 && ta.Dot(tb) < 0) {
+		// the offsets part around the outside of the corner
+		if !round && !a.isArc() && !b.isArc() {
+			for _, miter := range lineLineIntersections(a.Start, a.End, b.Start, b.End) {
+				if miter.DistanceTo(vertex) <= MiterLimit*math.Abs(delta) {
+					a.End, b.Start = miter, miter
+					return a, b, nil, true
+				}
+			}
+			return a, b, []Segment{NewLine(a.End, b.Start)}, true
+		}
+		sweep := a.End.Sub(vertex).AngleTo(b.Start.Sub(vertex))
+		if sweep*delta < 0 {
+			sweep += math.Copysign(2*math.Pi, delta)
+		}
+		return a, b, []Segment{{Kind: SegmentArc, Start: a.End, End: b.Start, Center: vertex, Sweep: sweep}}, true
+	}
+
+	// the offsets overlap inside the corner, so both are cut back to where they cross
+	best := math.Inf(1)
+	var cross vector2.Vector2
+	for _, pt := range a.intersections(b) {
+		if d := pt.DistanceTo(vertex); d < best {
+			best, cross = d, pt
+		}
+	}
+	if math.IsInf(best, 1) {
+		return a, b, nil, false
+	}
+	a, okA := a.withEnd(cross)
+	b, okB := b.withStart(cross)
+	return a, b, nil, okA && okB
+}
+
+// capSegments adds the end caps to an offset open path, which was offset by delta from a path
+// starting at first in direction t0 and ending at last in direction t1.
+func capSegments(segs []Segment, first, t0, last, t1 vector2.Vector2, delta float64, cap EndCap) []Segment {
+	if len(segs) == 0 || cap == EndCapButt {
+		return segs
+	}
+	d := math.Abs(delta)
+	start, end := segs[0].Start, segs[len(segs)-1].End
+
+	var head, tail Segment
+	if cap == EndCapSquare {
+		head = NewLine(start.Sub(t0.Mulf(d)), start)
+		tail = NewLine(end, end.Add(t1.Mulf(d)))
+	} else {
+		// a quarter turn around each end, from and back to the line of the path
+		sweep := math.Copysign(math.Pi*0.5, delta)
+		head = Segment{Kind: SegmentArc, Start: first.Sub(t0.Mulf(d)), End: start, Center: first, Sweep: sweep}
+		tail = Segment{Kind: SegmentArc, Start: end, End: last.Add(t1.Mulf(d)), Center: last, Sweep: sweep}
+	}
+	res := append([]Segment{head}, segs...)
+	return append(res, tail)
+}
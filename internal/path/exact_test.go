@@ -0,0 +1,101 @@
+package path
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Anaxarchus/zero-gdscript/pkg/vector2"
+)
+
+func TestSegmentOffsetArcRadius(t *testing.T) {
+	center := vector2.New(1, 1)
+	tests := []struct {
+		name   string
+		sweep  float64
+		delta  float64
+		radius float64
+	}{
+		// the right of a counter-clockwise arc is outside it
+		{"counter-clockwise outward", math.Pi / 2, 0.25, 2.25},
+		{"counter-clockwise inward", math.Pi / 2, -0.25, 1.75},
+		{"clockwise inward", -math.Pi / 2, 0.25, 1.75},
+		{"clockwise outward", -math.Pi / 2, -0.25, 2.25},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			arc := NewArcSegment(center, center.Add(vector2.New(2, 0)), tt.sweep)
+			off, ok := arc.offset(tt.delta)
+			if !ok {
+				t.Fatal("offset arc vanished")
+			}
+			if off.Kind != SegmentArc || !near(off.Center, center) || off.Sweep != tt.sweep {
+				t.Errorf("offset = %+v, want an arc about %v sweeping %v", off, center, tt.sweep)
+			}
+			if math.Abs(off.Radius()-tt.radius) > testTolerance {
+				t.Errorf("radius = %v, want %v", off.Radius(), tt.radius)
+			}
+		})
+	}
+}
+
+func TestOffsetClosedArcs(t *testing.T) {
+	// a circle of radius 2 made of two half circles, counter-clockwise
+	circle := NewPathFromSegments(true,
+		NewArcSegment(vector2.Zero(), vector2.New(2, 0), math.Pi),
+		NewArcSegment(vector2.Zero(), vector2.New(-2, 0), math.Pi),
+	).Densify(ArcTolerance)
+	tests := []struct {
+		name   string
+		delta  float64
+		radius float64
+	}{
+		{"grow", 0.25, 2.25},
+		{"shrink", -0.25, 1.75},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			off := circle.Offset(tt.delta, true)
+			if len(off.Segments) == 0 {
+				t.Fatal("offset lost its segments")
+			}
+			for _, seg := range off.Segments {
+				if seg.Kind != SegmentArc || math.Abs(seg.Radius()-tt.radius) > testTolerance {
+					t.Errorf("segment %+v, want an arc of radius %v", seg, tt.radius)
+				}
+			}
+		})
+	}
+}
+
+func TestOffsetEndCaps(t *testing.T) {
+	line := NewPathFromSegments(false, NewLine(vector2.Zero(), vector2.New(4, 0))).Densify(ArcTolerance)
+	tests := []struct {
+		name       string
+		cap        EndCap
+		start, end vector2.Vector2
+		length     float64
+	}{
+		{"butt", EndCapButt, vector2.New(0, -0.5), vector2.New(4, -0.5), 4},
+		{"square", EndCapSquare, vector2.New(-0.5, -0.5), vector2.New(4.5, -0.5), 5},
+		{"round", EndCapRound, vector2.New(-0.5, 0), vector2.New(4.5, 0), 4 + math.Pi*0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// positive offsets shift open paths to the right of travel
+			off := line.OffsetCapped(0.5, false, tt.cap)
+			segs := off.Segments
+			if len(segs) == 0 {
+				t.Fatal("offset has no segments")
+			}
+			if !near(segs[0].Start, tt.start) || !near(segs[len(segs)-1].End, tt.end) {
+				t.Errorf("runs %v to %v, want %v to %v", segs[0].Start, segs[len(segs)-1].End, tt.start, tt.end)
+			}
+			if l := pathLength(segs); math.Abs(l-tt.length) > testTolerance {
+				t.Errorf("length = %v, want %v", l, tt.length)
+			}
+			if !near(off.Points[0], tt.start) || !near(off.Points[len(off.Points)-1], tt.end) {
+				t.Errorf("points run %v to %v, want %v to %v", off.Points[0], off.Points[len(off.Points)-1], tt.start, tt.end)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package path
+
+import (
+	"math"
+
+	"github.com/Anaxarchus/zero-gdscript/pkg/vector2"
+	clipper "github.com/ctessum/go.clipper"
+)
+
+// clipper works on integer coordinates, so points are scaled into fixed point before offsetting.
+const clipperScale = 100000000.0
+
+// ArcTolerance is the maximum distance a rounded join may deviate from the true arc.
+const ArcTolerance = 0.001
+
+// MiterLimit is the multiple of the offset distance a mitered corner may extend to.
+const MiterLimit = 4.0
+
+// offsetPoints offsets the points with clipper and returns every resulting polygon.
+// geometry2d.OffsetPolygon pads its results with empty polygons and zero points,
+// so the clipper call is made directly here.
+func offsetPoints(points []vector2.Vector2, delta float64, jt clipper.JoinType, et clipper.EndType) [][]vector2.Vector2 {
+	co := clipper.NewClipperOffset()
+	co.ArcTolerance = ArcTolerance * clipperScale
+	co.MiterLimit = MiterLimit
+	if et == clipper.EtClosedPolygon {
+		points = withoutClosingPoint(points)
+	}
+	co.AddPath(toClipperPath(points), jt, et)
+
+	solutions := co.Execute(delta * clipperScale)
+	res := make([][]vector2.Vector2, 0, len(solutions))
+	for _, solution := range solutions {
+		res = append(res, fromClipperPath(solution))
+	}
+	return res
+}
+
+// withoutClosingPoint drops the repeated first point of a closed path. clipper closes polygons
+// itself and mangles the joins around a zero length closing edge.
+func withoutClosingPoint(points []vector2.Vector2) []vector2.Vector2 {
+	if len(points) > 1 && points[0].IsEqualApprox(points[len(points)-1]) {
+		return points[:len(points)-1]
+	}
+	return points
+}
+
+func toClipperPath(points []vector2.Vector2) clipper.Path {
+	cp := clipper.NewPath()
+	for _, pt := range points {
+		cp = append(cp, &clipper.IntPoint{
+			X: clipper.CInt(math.Round(pt.X * clipperScale)),
+			Y: clipper.CInt(math.Round(pt.Y * clipperScale)),
+		})
+	}
+	return cp
+}
+
+func fromClipperPath(cp clipper.Path) []vector2.Vector2 {
+	points := make([]vector2.Vector2, 0, len(cp))
+	for _, pt := range cp {
+		points = append(points, vector2.New(float64(pt.X)/clipperScale, float64(pt.Y)/clipperScale))
+	}
+	return points
+}
+
+// largestPolygon returns the polygon with the greatest enclosed area.
+func largestPolygon(polygons [][]vector2.Vector2) []vector2.Vector2 {
+	var res []vector2.Vector2
+	best := -1.0
+	for _, poly := range polygons {
+		a := math.Abs(Area(poly))
+		if a > best {
+			best = a
+			res = poly
+		}
+	}
+	return res
+}
+
+// Area returns the signed area of the polygon, positive when it winds counter-clockwise.
+func Area(points []vector2.Vector2) float64 {
+	var a float64
+	for i := range points {
+		j := (i + 1) % len(points)
+		a += points[i].Cross(points[j])
+	}
+	return a * 0.5
+}
+
+// ExactAreaTolerance is the largest relative difference between the areas enclosed by the exact and
+// the clipper offsets of a closed path for the exact offset to be used.
+const ExactAreaTolerance = 0.001
+
+// offsetOpenPoints shifts the points of an open path sideways by delta, positive to the right of the
+// direction of travel. Corners are mitered up to MiterLimit and beveled beyond it.
+func (p Path) offsetOpenPoints(delta float64) []vector2.Vector2 {
+	var pts []vector2.Vector2
+	for _, pt := range p.Points {
+		if len(pts) == 0 || !pts[len(pts)-1].IsEqualApprox(pt) {
+			pts = append(pts, pt)
+		}
+	}
+	if len(pts) < 2 || delta == 0.0 {
+		return pts
+	}
+
+	normals := make([]vector2.Vector2, len(pts)-1)
+	for i := range normals {
+		dir := pts[i].DirectionTo(pts[i+1])
+		normals[i] = vector2.New(dir.Y, -dir.X).Mulf(delta)
+	}
+
+	offset := []vector2.Vector2{pts[0].Add(normals[0])}
+	for i := 1; i < len(pts)-1; i++ {
+		a := pts[i].Add(normals[i-1])
+		b := pts[i].Add(normals[i])
+		if a.IsEqualApprox(b) {
+			offset = append(offset, a)
+			continue
+		}
+
+		// intersect the two shifted edges, falling back to a bevel on spikes and parallel edges
+		da := pts[i-1].DirectionTo(pts[i])
+		db := pts[i].DirectionTo(pts[i+1])
+		denom := db.Y*da.X - db.X*da.Y
+		if math.Abs(denom) < 1e-9 {
+			offset = append(offset, a, b)
+			continue
+		}
+		v := a.Sub(b)
+		t := (db.X*v.Y - db.Y*v.X) / denom
+		miter := a.Add(da.Mulf(t))
+		if miter.DistanceTo(pts[i]) > MiterLimit*math.Abs(delta) {
+			offset = append(offset, a, b)
+		} else {
+			offset = append(offset, miter)
+		}
+	}
+	offset = append(offset, pts[len(pts)-1].Add(normals[len(normals)-1]))
+
+	return offset
+}
+
+// OffsetRegion offsets the region enclosed by boundary, with the islands cut out of it, by delta.
+// Negative deltas shrink the region and grow its islands. Each loop of the result is a polygon,
+// without a repeated closing point.
+func OffsetRegion(boundary []vector2.Vector2, islands [][]vector2.Vector2, delta float64, rollingPath bool) [][]vector2.Vector2 {
+	// clipper tells holes from outlines by their winding
+	loops := [][]vector2.Vector2{withWinding(withoutClosingPoint(boundary), true)}
+	for _, island := range islands {
+		loops = append(loops, withWinding(withoutClosingPoint(island), false))
+	}
+	return OffsetLoops(loops, delta, rollingPath)
+}
+
+// OffsetLoops offsets a region given as the loops clipper returns, outlines wound counter-clockwise
+// and holes clockwise, by delta.
+func OffsetLoops(loops [][]vector2.Vector2, delta float64, rollingPath bool) [][]vector2.Vector2 {
+	joinType := clipper.JtMiter
+	if rollingPath {
+		joinType = clipper.JtRound
+	}
+
+	co := clipper.NewClipperOffset()
+	co.ArcTolerance = ArcTolerance * clipperScale
+	co.MiterLimit = MiterLimit
+	for _, loop := range loops {
+		co.AddPath(toClipperPath(withoutClosingPoint(loop)), joinType, clipper.EtClosedPolygon)
+	}
+
+	solutions := co.Execute(delta * clipperScale)
+	res := make([][]vector2.Vector2, 0, len(solutions))
+	for _, solution := range solutions {
+		res = append(res, fromClipperPath(solution))
+	}
+	return res
+}
+
+// ClipLines cuts the polylines by the region enclosed by loops, keeping the pieces inside it when
+// inside is true and the pieces outside it otherwise.
+func ClipLines(lines, loops [][]vector2.Vector2, inside bool) [][]vector2.Vector2 {
+	c := clipper.NewClipper(clipper.IoNone)
+	for _, line := range lines {
+		c.AddPath(toClipperPath(line), clipper.PtSubject, false)
+	}
+	for _, loop := range loops {
+		c.AddPath(toClipperPath(withoutClosingPoint(loop)), clipper.PtClip, true)
+	}
+
+	clipType := clipper.CtDifference
+	if inside {
+		clipType = clipper.CtIntersection
+	}
+	tree, ok := c.Execute2(clipType, clipper.PftNonZero, clipper.PftEvenOdd)
+	if !ok {
+		return nil
+	}
+
+	var res [][]vector2.Vector2
+	for _, piece := range c.OpenPathsFromPolyTree(tree) {
+		res = append(res, fromClipperPath(piece))
+	}
+	return res
+}
+
+// withWinding returns the points wound counter-clockwise when ccw is true, clockwise otherwise.
+func withWinding(points []vector2.Vector2, ccw bool) []vector2.Vector2 {
+	if (Area(points) > 0) == ccw {
+		return points
+	}
+	res := make([]vector2.Vector2, len(points))
+	for i, pt := range points {
+		res[len(points)-1-i] = pt
+	}
+	return res
+}
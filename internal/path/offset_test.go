@@ -0,0 +1,149 @@
+package path
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Anaxarchus/zero-gdscript/pkg/vector2"
+)
+
+// square returns the corners of the square of side 2 about the origin, counter-clockwise.
+func square() []vector2.Vector2 {
+	return []vector2.Vector2{vector2.New(-1, -1), vector2.New(1, -1), vector2.New(1, 1), vector2.New(-1, 1)}
+}
+
+func reversedPoints(points []vector2.Vector2) []vector2.Vector2 {
+	res := make([]vector2.Vector2, len(points))
+	for i, pt := range points {
+		res[len(points)-1-i] = pt
+	}
+	return res
+}
+
+func TestArea(t *testing.T) {
+	tests := []struct {
+		name   string
+		points []vector2.Vector2
+		area   float64
+	}{
+		{"counter-clockwise", square(), 4},
+		{"clockwise", reversedPoints(square()), -4},
+		{"closing point repeated", append(square(), square()[0]), 4},
+		{"line", []vector2.Vector2{vector2.Zero(), vector2.New(1, 0)}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Area(tt.points); math.Abs(got-tt.area) > testTolerance {
+				t.Errorf("Area = %v, want %v", got, tt.area)
+			}
+		})
+	}
+}
+
+func TestPointInPolygon(t *testing.T) {
+	// an L, to have a concave corner
+	ell := []vector2.Vector2{vector2.New(0, 0), vector2.New(2, 0), vector2.New(2, 1), vector2.New(1, 1), vector2.New(1, 2), vector2.New(0, 2)}
+	tests := []struct {
+		name   string
+		point  vector2.Vector2
+		inside bool
+	}{
+		{"in the foot", vector2.New(1.5, 0.5), true},
+		{"in the leg", vector2.New(0.5, 1.5), true},
+		{"in the notch", vector2.New(1.5, 1.5), false},
+		{"beside it", vector2.New(3, 0.5), false},
+		{"below it", vector2.New(0.5, -1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PointInPolygon(tt.point, ell); got != tt.inside {
+				t.Errorf("PointInPolygon(%v) = %v, want %v", tt.point, got, tt.inside)
+			}
+			if got := PointInPolygon(tt.point, reversedPoints(ell)); got != tt.inside {
+				t.Errorf("wound the other way, PointInPolygon(%v) = %v, want %v", tt.point, got, tt.inside)
+			}
+		})
+	}
+}
+
+func TestOffsetClosed(t *testing.T) {
+	tests := []struct {
+		name    string
+		points  []vector2.Vector2
+		delta   float64
+		rolling bool
+		area    float64
+	}{
+		{"grow mitered", square(), 0.5, false, 9},
+		{"grow rolling", square(), 0.5, true, 8 + math.Pi*0.25},
+		{"shrink", square(), -0.5, false, 1},
+		{"shrink clockwise", reversedPoints(square()), -0.5, false, 1},
+		{"shrink to nothing", square(), -1.5, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			off := NewPath(append(tt.points, tt.points[0]), true).Offset(tt.delta, tt.rolling)
+			// rounded corners are flattened to within ArcTolerance
+			if got := math.Abs(Area(off.Points)); math.Abs(got-tt.area) > 1e-2 {
+				t.Errorf("area = %v, want %v", got, tt.area)
+			}
+			for _, pt := range off.Points {
+				if d := math.Max(math.Abs(pt.X), math.Abs(pt.Y)); d > 1+tt.delta+testTolerance {
+					t.Errorf("point %v is further out than %v", pt, 1+tt.delta)
+				}
+			}
+		})
+	}
+}
+
+func TestOffsetOpen(t *testing.T) {
+	line := NewPath([]vector2.Vector2{vector2.Zero(), vector2.New(2, 0), vector2.New(2, 2)}, false)
+	tests := []struct {
+		name  string
+		delta float64
+		start vector2.Vector2
+		end   vector2.Vector2
+	}{
+		// positive deltas shift to the right of travel
+		{"right", 0.25, vector2.New(0, -0.25), vector2.New(2.25, 2)},
+		{"left", -0.25, vector2.New(0, 0.25), vector2.New(1.75, 2)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			off := line.Offset(tt.delta, false)
+			if first, last := off.Points[0], off.Points[len(off.Points)-1]; !near(first, tt.start) || !near(last, tt.end) {
+				t.Errorf("offset runs %v to %v, want %v to %v", first, last, tt.start, tt.end)
+			}
+		})
+	}
+}
+
+func TestOffsetRegion(t *testing.T) {
+	island := []vector2.Vector2{vector2.New(-0.25, -0.25), vector2.New(0.25, -0.25), vector2.New(0.25, 0.25), vector2.New(-0.25, 0.25)}
+	tests := []struct {
+		name    string
+		islands [][]vector2.Vector2
+		delta   float64
+		loops   int
+		area    float64 // the area left, outlines less holes
+	}{
+		{"no islands", nil, -0.25, 1, 2.25},
+		{"island grows", [][]vector2.Vector2{island}, -0.25, 2, 2.25 - 1},
+		{"island swallows it", [][]vector2.Vector2{island}, -0.6, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loops := OffsetRegion(square(), tt.islands, tt.delta, false)
+			if len(loops) != tt.loops {
+				t.Fatalf("%d loops, want %d", len(loops), tt.loops)
+			}
+			var area float64
+			for _, loop := range loops {
+				area += Area(loop)
+			}
+			if math.Abs(area-tt.area) > 1e-3 {
+				t.Errorf("area = %v, want %v", area, tt.area)
+			}
+		})
+	}
+}
@@ -6,7 +6,9 @@ import (
 
 	zerogdscript "github.com/Anaxarchus/zero-gdscript"
 	"github.com/Anaxarchus/zero-gdscript/pkg/geometry2d"
+	"github.com/Anaxarchus/zero-gdscript/pkg/transform2d"
 	"github.com/Anaxarchus/zero-gdscript/pkg/vector2"
+	clipper "github.com/ctessum/go.clipper"
 )
 
 const MaxArcSegmentLength = 0.1
@@ -30,6 +32,10 @@ type Path struct {
 	Points []vector2.Vector2
 	Arcs   []*Arc
 	Closed bool
+	// Segments holds the exact lines and arcs of the path, when it is built from them. Points is
+	// then filled by Densify, to within Tolerance of them.
+	Segments  []Segment
+	Tolerance float64
 }
 
 func NewPath(points []vector2.Vector2, closed bool) *Path {
@@ -39,23 +45,66 @@ func NewPath(points []vector2.Vector2, closed bool) *Path {
 	}
 }
 
+// NewPathFromSegments builds a path of the segments, which run end to end. Its points are left
+// for Densify to fill.
+func NewPathFromSegments(closed bool, segs ...Segment) *Path {
+	return &Path{Segments: segs, Closed: closed}
+}
+
+// NewPathFromBulgePoints builds a path through points given with the bulge of the segment after them,
+// densified to within ArcTolerance of its arcs.
 func NewPathFromBulgePoints(closed bool, bpoints ...[3]float64) *Path {
-	var points []vector2.Vector2
+	segs := BulgeSegments(closed, bpoints)
+	if len(segs) == 0 {
+		var points []vector2.Vector2
+		for _, bp := range bpoints {
+			points = append(points, vector2.New(bp[0], bp[1]))
+		}
+		return NewPath(points, closed)
+	}
+	return NewPathFromSegments(closed, segs...).Densify(ArcTolerance)
+}
 
-	for i := 0; i < len(bpoints); i += 2 {
-		j := zerogdscript.Wrapi(i+1, 0, len(bpoints))
-		this := vector2.New(bpoints[i][0], bpoints[i][1])
-		next := vector2.New(bpoints[j][0], bpoints[j][1])
-		if bpoints[i][2] != 0.0 {
-			arc := BulgeToArc(this, next, bpoints[i][2])
-			arcPoints := ArcToPoints(arc.Position, arc.Radius, arc.AngleStart, arc.AngleEnd)
-			points = append(points, arcPoints...)
-		} else {
-			points = append(points, this, next)
+// Densify fills the points of the path from its segments, flattening arcs into chords that stray
+// no further than tolerance from them, and records the arcs exactly in Arcs, with their angles in
+// radians. Closed paths repeat their first point at the end. It returns the path.
+func (p *Path) Densify(tolerance float64) *Path {
+	if len(p.Segments) == 0 {
+		return p
+	}
+	points := []vector2.Vector2{p.Segments[0].Start}
+	var arcs []*Arc
+	for _, seg := range p.Segments {
+		first := len(points) - 1
+		points = append(points, seg.Densify(tolerance)...)
+		if seg.Kind != SegmentArc {
+			continue
 		}
+		indices := make([]int, 0, len(points)-first)
+		for k := first; k < len(points); k++ {
+			indices = append(indices, k)
+		}
+		start := seg.Center.AngleToPoint(seg.Start)
+		arcs = append(arcs, &Arc{Position: seg.Center, Radius: seg.Radius(), Points: indices, AngleStart: start, AngleEnd: start + seg.Sweep, path: p})
+	}
+	if p.Closed {
+		// the last segment ends where the first starts
+		points[len(points)-1] = points[0]
 	}
 
-	return NewPath(points, closed)
+	p.Points = points
+	p.Arcs = arcs
+	p.Tolerance = tolerance
+	return p
+}
+
+// densify fills the points of a path built from segments to the tolerance of the path it came from.
+func (p *Path) densify(from *Path) *Path {
+	tolerance := from.Tolerance
+	if tolerance <= 0 {
+		tolerance = ArcTolerance
+	}
+	return p.Densify(tolerance)
 }
 
 func (p *Path) Walk(from vector2.Vector2, distance float64) []Waypoint {
@@ -143,6 +192,7 @@ func (p *Path) NewArc(points []int) (*Arc, error) {
 
 func (p *Path) SetPoints(points []vector2.Vector2) {
 	p.Points = points
+	p.Segments = nil
 	p.Arcs = []*Arc{}
 	arcPoints := p.FindArcs()
 	for _, pts := range arcPoints {
@@ -153,25 +203,160 @@ func (p *Path) SetPoints(points []vector2.Vector2) {
 	}
 }
 
+// Offset offsets the path by delta. Closed paths grow by positive deltas and shrink by negative
+// ones. Open paths shift sideways, positive to the right of the direction of travel, and stop in
+// line with their ends. Corners the offset goes around are rounded on rolling paths and mitered
+// otherwise.
 func (p Path) Offset(delta float64, rollingPath bool) *Path {
-	var offset []vector2.Vector2
+	return p.OffsetCapped(delta, rollingPath, EndCapButt)
+}
 
-	if p.Closed {
+// OffsetCapped offsets the path as Offset does, finishing open paths with the end cap. Paths built
+// from bulges are offset exactly, so their arcs stay arcs of the same center, where the offset
+// allows it. Otherwise closed paths are offset by clipper, and open ones point by point.
+func (p Path) OffsetCapped(delta float64, rollingPath bool, cap EndCap) *Path {
+	if len(p.Points) == 0 {
+		p.densify(&p)
+	}
+	if delta == 0.0 || len(p.Points) < 2 {
+		return &p
+	}
 
-		joinType := geometry2d.JoinTypeMiter
+	if p.Closed {
+		joinType := clipper.JtMiter
 		if rollingPath {
-			joinType = geometry2d.JoinTypeRound
+			joinType = clipper.JtRound
+		}
+		offset := largestPolygon(offsetPoints(p.Points, delta, joinType, clipper.EtClosedPolygon))
+
+		// the right of a counter-clockwise loop is outside it
+		side := delta
+		if Area(p.Points) < 0 {
+			side = -delta
+		}
+		if segs, ok := offsetSegments(p.Segments, side, true, rollingPath); ok {
+			exact := NewPathFromSegments(true, segs...).densify(&p)
+			// an exact offset that crosses itself encloses a different area to clipper's
+			if a := math.Abs(Area(exact.Points)); math.Abs(a-math.Abs(Area(offset))) <= ExactAreaTolerance*math.Max(a, 1) {
+				return exact
+			}
 		}
 
-		offset = geometry2d.OffsetPolygon(p.Points, delta, joinType)[0]
 		if len(offset) > 0 {
 			offset = append(offset, offset[0])
 		}
-
 		p.SetPoints(offset)
+		return &p
+	}
+
+	source := p.Segments
+	if len(source) == 0 {
+		source = LineSegments(p.Points)
+	}
+	if len(source) == 0 {
+		return &p
+	}
+	segs, ok := offsetSegments(source, delta, false, rollingPath)
+	if !ok {
+		segs = LineSegments(p.offsetOpenPoints(delta))
+	}
+	first, last := source[0], source[len(source)-1]
+	segs = capSegments(segs, first.Start, first.tangent(first.Start), last.End, last.tangent(last.End), delta, cap)
+	return NewPathFromSegments(false, segs...).densify(&p)
+}
+
+// Reversed returns the path running the other way. Closed paths keep their start.
+func (p Path) Reversed() *Path {
+	if len(p.Segments) > 0 {
+		segs := make([]Segment, len(p.Segments))
+		for i, seg := range p.Segments {
+			segs[len(segs)-1-i] = seg.Reversed()
+		}
+		return NewPathFromSegments(p.Closed, segs...).densify(&p)
+	}
 
+	points := make([]vector2.Vector2, len(p.Points))
+	for i, pt := range p.Points {
+		points[len(p.Points)-1-i] = pt
+	}
+	return NewPath(points, p.Closed)
+}
+
+// segmentAt returns the index of the segment at distance d along the path and the distance along
+// that segment. Closed paths wrap around, and open ones stop at their ends.
+func (p *Path) segmentAt(d float64) (int, float64) {
+	if p.Closed {
+		if length := p.Length(); length > 0 {
+			d = math.Mod(d, length)
+			if d < 0 {
+				d += length
+			}
+		}
+	}
+	for i, seg := range p.Segments {
+		l := seg.Length()
+		if d <= l || i == len(p.Segments)-1 {
+			return i, d
+		}
+		d -= l
 	}
-	return &p
+	return -1, 0
+}
+
+// PointAt returns the point at distance d along the path built from segments.
+func (p *Path) PointAt(d float64) vector2.Vector2 {
+	i, along := p.segmentAt(d)
+	if i < 0 {
+		return vector2.Zero()
+	}
+	return p.Segments[i].PointAt(along)
+}
+
+// TangentAt returns the direction of travel at distance d along the path built from segments.
+func (p *Path) TangentAt(d float64) vector2.Vector2 {
+	i, along := p.segmentAt(d)
+	if i < 0 {
+		return vector2.Zero()
+	}
+	return p.Segments[i].TangentAt(along)
+}
+
+// Split cuts the path built from segments at distance d along it into the open paths before and
+// after. A closed path is cut open at its start first.
+func (p *Path) Split(d float64) (*Path, *Path) {
+	i, along := p.segmentAt(d)
+	if i < 0 {
+		return NewPathFromSegments(false), NewPathFromSegments(false)
+	}
+	before := append([]Segment(nil), p.Segments[:i]...)
+	after := []Segment{}
+	head, tail := p.Segments[i].Split(along)
+	if head.Length() > segmentTolerance {
+		before = append(before, head)
+	}
+	if tail.Length() > segmentTolerance {
+		after = append(after, tail)
+	}
+	after = append(after, p.Segments[i+1:]...)
+	return NewPathFromSegments(false, before...).densify(p), NewPathFromSegments(false, after...).densify(p)
+}
+
+// Transformed returns the path moved by the transform, which should only rotate, reflect, scale
+// evenly and translate.
+func (p Path) Transformed(t transform2d.Transform2D) *Path {
+	if len(p.Segments) > 0 {
+		segs := make([]Segment, len(p.Segments))
+		for i, seg := range p.Segments {
+			segs[i] = seg.Transformed(t)
+		}
+		return NewPathFromSegments(p.Closed, segs...).densify(&p)
+	}
+
+	points := make([]vector2.Vector2, len(p.Points))
+	for i, pt := range p.Points {
+		points[i] = t.Xform(pt)
+	}
+	return NewPath(points, p.Closed)
 }
 
 func (p *Path) LengthToIndex(index int) float64 {
@@ -182,12 +367,23 @@ func (p *Path) LengthToIndex(index int) float64 {
 	return math.Sqrt(d)
 }
 
+// Length returns the length of the path, exactly when it is built from segments.
 func (p *Path) Length() float64 {
+	if len(p.Segments) > 0 {
+		var l float64
+		for _, seg := range p.Segments {
+			l += seg.Length()
+		}
+		return l
+	}
 	var l float64
-	for i := 0; i < len(p.Points); i++ {
-		l += p.Points[i].DistanceSquaredTo(p.Points[zerogdscript.Wrapi(i+1, 0, len(p.Points))])
+	for i := 0; i+1 < len(p.Points); i++ {
+		l += p.Points[i].DistanceTo(p.Points[i+1])
+	}
+	if p.Closed && len(p.Points) > 1 {
+		l += p.Points[len(p.Points)-1].DistanceTo(p.Points[0])
 	}
-	return math.Sqrt(l)
+	return l
 }
 
 func (p *Path) GetNearestEdge(to vector2.Vector2) [2]int {
@@ -394,3 +590,15 @@ func FindPoint(point vector2.Vector2, points []vector2.Vector2) int {
 	}
 	return -1
 }
+
+// PointInPolygon reports whether point lies inside the polygon, by the even-odd rule.
+func PointInPolygon(point vector2.Vector2, polygon []vector2.Vector2) bool {
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		a, b := polygon[i], polygon[j]
+		if (a.Y > point.Y) != (b.Y > point.Y) && point.X < (b.X-a.X)*(point.Y-a.Y)/(b.Y-a.Y)+a.X {
+			inside = !inside
+		}
+	}
+	return inside
+}
@@ -0,0 +1,75 @@
+package path
+
+import (
+	"math"
+
+	"github.com/Anaxarchus/zero-gdscript/pkg/vector2"
+)
+
+// Corner relief styles.
+const (
+	ReliefDogBone = "dogbone"
+	ReliefTBone   = "tbone"
+)
+
+// Wall is the side of a tool path the cut wall lies on, looking along travel.
+type Wall int
+
+const (
+	WallLeft Wall = iota
+	WallRight
+	WallBoth // the tool cuts on its centre line, leaving a wall either side
+)
+
+// CornerRelief returns the path with relief moves added at the corners a round tool can't reach.
+// The path is the centre of a tool of the radius, running a radius from the wall, which lies on the
+// given side of travel. Centre line cuts have walls on both sides and relieve the outside of every
+// turn. Corners of the wall with an interior angle of at most
+// maxAngle radians are relieved: dog-bones reach along the corner's bisector until the tool touches
+// the corner, and T-bones run on along the incoming edge, cutting into the wall ahead.
+func (p Path) CornerRelief(style string, radius, maxAngle float64, wall Wall) *Path {
+	var pts []vector2.Vector2
+	for _, pt := range p.Points {
+		if len(pts) == 0 || !pts[len(pts)-1].IsEqualApprox(pt) {
+			pts = append(pts, pt)
+		}
+	}
+	if p.Closed && len(pts) > 1 && pts[0].IsEqualApprox(pts[len(pts)-1]) {
+		pts = pts[:len(pts)-1]
+	}
+	if len(pts) < 3 || radius <= 0 || (style != ReliefDogBone && style != ReliefTBone) {
+		return &p
+	}
+
+	res := make([]vector2.Vector2, 0, len(pts))
+	for i, v := range pts {
+		if !p.Closed && (i == 0 || i == len(pts)-1) {
+			res = append(res, v)
+			continue
+		}
+		prev := pts[(i+len(pts)-1)%len(pts)]
+		next := pts[(i+1)%len(pts)]
+		a := prev.DirectionTo(v)
+		b := v.DirectionTo(next)
+		turn := a.AngleTo(b)
+
+		// only corners turning away from the wall hold material the tool can't reach
+		if (wall != WallBoth && (turn > 0) != (wall == WallRight)) || math.Pi-math.Abs(turn) > maxAngle || math.Pi-math.Abs(turn) < 1e-6 {
+			res = append(res, v)
+			continue
+		}
+		half := math.Abs(turn) * 0.5
+		var relief vector2.Vector2
+		if style == ReliefDogBone {
+			relief = v.Add(a.Sub(b).Normalized().Mulf(radius/math.Cos(half) - radius))
+		} else {
+			relief = v.Add(a.Mulf(radius * math.Tan(half)))
+		}
+		res = append(res, v, relief, v)
+	}
+
+	if p.Closed {
+		res = append(res, res[0])
+	}
+	return NewPath(res, p.Closed)
+}
@@ -0,0 +1,69 @@
+package path
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCornerRelief(t *testing.T) {
+	const radius = 0.25
+	// the tool path inside a pocket, climbing counter-clockwise, with the wall on its right
+	pocket := func() *Path { return NewPath(append(square(), square()[0]), true) }
+	dogbone := radius*math.Sqrt2 - radius
+	tests := []struct {
+		name    string
+		path    *Path
+		style   string
+		angle   float64
+		wall    Wall
+		reliefs int
+		reach   float64 // how far each relief move reaches past its corner
+	}{
+		{"dog-bone", pocket(), ReliefDogBone, math.Pi / 2, WallRight, 4, dogbone},
+		{"T-bone", pocket(), ReliefTBone, math.Pi / 2, WallRight, 4, radius},
+		{"wall on the other side", pocket(), ReliefDogBone, math.Pi / 2, WallLeft, 0, 0},
+		{"centre line", pocket(), ReliefDogBone, math.Pi / 2, WallBoth, 4, dogbone},
+		{"corners too open", pocket(), ReliefDogBone, math.Pi / 3, WallRight, 0, 0},
+		{"unknown style", pocket(), "fillet", math.Pi / 2, WallRight, 0, 0},
+		// open paths have no corner at their ends
+		{"open", NewPath(square(), false), ReliefDogBone, math.Pi / 2, WallRight, 2, dogbone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			corners := square()
+			got := tt.path.CornerRelief(tt.style, radius, tt.angle, tt.wall)
+
+			reliefs := 0
+			for _, pt := range got.Points {
+				if FindPoint(pt, corners) >= 0 {
+					continue
+				}
+				reliefs++
+				best := math.Inf(1)
+				for _, c := range corners {
+					best = math.Min(best, pt.DistanceTo(c))
+				}
+				if math.Abs(best-tt.reach) > testTolerance {
+					t.Errorf("relief at %v reaches %v past its corner, want %v", pt, best, tt.reach)
+				}
+				// every relief goes out of the square, into the corner of the wall
+				if math.Max(math.Abs(pt.X), math.Abs(pt.Y)) <= 1 {
+					t.Errorf("relief at %v stays inside the path", pt)
+				}
+			}
+			if reliefs != tt.reliefs {
+				t.Errorf("%d reliefs, want %d", reliefs, tt.reliefs)
+			}
+		})
+	}
+}
+
+func TestCornerReliefReturns(t *testing.T) {
+	got := NewPath(append(square(), square()[0]), true).CornerRelief(ReliefDogBone, 0.25, math.Pi/2, WallRight)
+	// each relief is an out and back move, so the tool carries on from the corner it left
+	for i := 1; i+1 < len(got.Points); i++ {
+		if FindPoint(got.Points[i], square()) < 0 && !got.Points[i-1].IsEqualApprox(got.Points[i+1]) {
+			t.Errorf("relief at %v leaves from %v and comes back to %v", got.Points[i], got.Points[i-1], got.Points[i+1])
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package path
+
+import (
+	"math"
+
+	"github.com/Anaxarchus/zero-gdscript/pkg/transform2d"
+	"github.com/Anaxarchus/zero-gdscript/pkg/vector2"
+)
+
+// segmentTolerance is the distance below which segment ends are taken to meet.
+const segmentTolerance = 1e-7
+
+// SegmentKind is the shape of a segment.
+type SegmentKind int
+
+const (
+	SegmentLine SegmentKind = iota
+	SegmentArc
+)
+
+func (k SegmentKind) String() string {
+	switch k {
+	case SegmentLine:
+		return "line"
+	case SegmentArc:
+		return "arc"
+	default:
+		return "unknown"
+	}
+}
+
+// Segment is a piece of a path: a straight line from Start to End, or an arc from Start to End about
+// Center, sweeping Sweep radians, positive counter-clockwise.
+type Segment struct {
+	Kind       SegmentKind
+	Start, End vector2.Vector2
+	Center     vector2.Vector2
+	Sweep      float64
+}
+
+// NewLine returns the line from start to end.
+func NewLine(start, end vector2.Vector2) Segment {
+	return Segment{Kind: SegmentLine, Start: start, End: end}
+}
+
+// NewArcSegment returns the arc about center from start, sweeping sweep radians, positive counter-clockwise.
+func NewArcSegment(center, start vector2.Vector2, sweep float64) Segment {
+	return Segment{Kind: SegmentArc, Start: start, End: rotate(start, center, sweep), Center: center, Sweep: sweep}
+}
+
+// BulgeSegment returns the segment from start to end described by the bulge, the tangent of a
+// quarter of the arc's sweep. A bulge of zero is a line.
+// ## @tutorial(source): http://www.lee-mac.com/bulgeconversion.html#bulgearc
+func BulgeSegment(start, end vector2.Vector2, bulge float64) Segment {
+	if math.Abs(bulge) < 1e-7 {
+		return NewLine(start, end)
+	}
+	// signed radius, so the center lands on the correct side of the chord
+	radius := (start.DistanceTo(end) * (1.0 + bulge*bulge)) / (4.0 * bulge)
+	angle := start.AngleToPoint(end) + math.Pi/2.0 - 2.0*math.Atan(bulge)
+	return Segment{
+		Kind:   SegmentArc,
+		Start:  start,
+		End:    end,
+		Center: start.Add(vector2.New(math.Cos(angle), math.Sin(angle)).Mulf(radius)),
+		Sweep:  4.0 * math.Atan(bulge),
+	}
+}
+
+// BulgeSegments returns the segments of a chain given as points with the bulge of the segment after
+// them, leaving out segments of no length.
+func BulgeSegments(closed bool, bpoints [][3]float64) []Segment {
+	var segs []Segment
+	for i := range bpoints {
+		if !closed && i == len(bpoints)-1 {
+			break
+		}
+		j := (i + 1) % len(bpoints)
+		start := vector2.New(bpoints[i][0], bpoints[i][1])
+		end := vector2.New(bpoints[j][0], bpoints[j][1])
+		if start.DistanceTo(end) > segmentTolerance {
+			segs = append(segs, BulgeSegment(start, end, bpoints[i][2]))
+		}
+	}
+	return segs
+}
+
+// LineSegments returns the lines between the points, leaving out those of no length.
+func LineSegments(points []vector2.Vector2) []Segment {
+	var segs []Segment
+	for i := 0; i+1 < len(points); i++ {
+		if points[i].DistanceTo(points[i+1]) > segmentTolerance {
+			segs = append(segs, NewLine(points[i], points[i+1]))
+		}
+	}
+	return segs
+}
+
+func (s Segment) isArc() bool {
+	return s.Kind == SegmentArc
+}
+
+// Radius returns the radius of an arc, or zero for a line.
+func (s Segment) Radius() float64 {
+	if !s.isArc() {
+		return 0
+	}
+	return s.Center.DistanceTo(s.Start)
+}
+
+// Bulge returns the bulge of the segment, zero for a line.
+func (s Segment) Bulge() float64 {
+	if !s.isArc() {
+		return 0
+	}
+	return math.Tan(s.Sweep / 4.0)
+}
+
+// Length returns the length of the segment.
+func (s Segment) Length() float64 {
+	if !s.isArc() {
+		return s.Start.DistanceTo(s.End)
+	}
+	return s.Radius() * math.Abs(s.Sweep)
+}
+
+// PointAt returns the point at distance d along the segment from its start, clamped to its ends.
+func (s Segment) PointAt(d float64) vector2.Vector2 {
+	length := s.Length()
+	if length < segmentTolerance || d <= 0 {
+		return s.Start
+	}
+	if d >= length {
+		return s.End
+	}
+	if !s.isArc() {
+		return s.Start.Add(s.Start.DirectionTo(s.End).Mulf(d))
+	}
+	return rotate(s.Start, s.Center, s.Sweep*d/length)
+}
+
+// TangentAt returns the direction of travel at distance d along the segment.
+func (s Segment) TangentAt(d float64) vector2.Vector2 {
+	return s.tangent(s.PointAt(d))
+}
+
+// tangent returns the direction of travel at pt on the segment.
+func (s Segment) tangent(pt vector2.Vector2) vector2.Vector2 {
+	if !s.isArc() {
+		return s.Start.DirectionTo(s.End)
+	}
+	r := s.Center.DirectionTo(pt)
+	if s.Sweep > 0 {
+		return vector2.New(-r.Y, r.X)
+	}
+	return vector2.New(r.Y, -r.X)
+}
+
+// Reversed returns the segment running the other way.
+func (s Segment) Reversed() Segment {
+	return Segment{Kind: s.Kind, Start: s.End, End: s.Start, Center: s.Center, Sweep: -s.Sweep}
+}
+
+// Split cuts the segment at distance d along it into the pieces before and after.
+func (s Segment) Split(d float64) (Segment, Segment) {
+	pt := s.PointAt(d)
+	before, after := s, s
+	before.End, after.Start = pt, pt
+	if s.isArc() {
+		length := s.Length()
+		t := math.Min(math.Max(d/length, 0), 1)
+		before.Sweep, after.Sweep = s.Sweep*t, s.Sweep*(1-t)
+	}
+	return before, after
+}
+
+// Transformed returns the segment moved by the transform, which should only rotate, reflect, scale
+// evenly and translate, so arcs stay arcs.
+func (s Segment) Transformed(t transform2d.Transform2D) Segment {
+	res := Segment{Kind: s.Kind, Start: t.Xform(s.Start), End: t.Xform(s.End), Sweep: s.Sweep}
+	if s.isArc() {
+		res.Center = t.Xform(s.Center)
+		// reflections turn arcs the other way
+		if t.Columns[0].X*t.Columns[1].Y-t.Columns[1].X*t.Columns[0].Y < 0 {
+			res.Sweep = -s.Sweep
+		}
+	}
+	return res
+}
+
+// Densify returns the points of the segment after its start, up to and including its end, with arcs
+// flattened into chords that stray no further than tolerance from them.
+func (s Segment) Densify(tolerance float64) []vector2.Vector2 {
+	if !s.isArc() {
+		return []vector2.Vector2{s.End}
+	}
+	r := s.Radius()
+	step := math.Pi * 0.5
+	if tolerance > 0 && tolerance < r {
+		// the sagitta of a chord spanning step is r(1 - cos(step/2))
+		step = math.Min(step, 2*math.Acos(1-tolerance/r))
+	}
+	count := max(int(math.Ceil(math.Abs(s.Sweep)/step-1e-9)), 1)
+	points := make([]vector2.Vector2, 0, count)
+	for i := 1; i < count; i++ {
+		points = append(points, rotate(s.Start, s.Center, s.Sweep*float64(i)/float64(count)))
+	}
+	return append(points, s.End)
+}
+
+// rotate turns pt about center by angle radians, positive counter-clockwise.
+func rotate(pt, center vector2.Vector2, angle float64) vector2.Vector2 {
+	v := pt.Sub(center)
+	sin, cos := math.Sincos(angle)
+	return center.Add(vector2.New(v.X*cos-v.Y*sin, v.X*sin+v.Y*cos))
+}
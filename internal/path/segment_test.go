@@ -0,0 +1,131 @@
+package path
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Anaxarchus/zero-gdscript/pkg/transform2d"
+	"github.com/Anaxarchus/zero-gdscript/pkg/vector2"
+)
+
+const testTolerance = 1e-6
+
+func near(a, b vector2.Vector2) bool {
+	return a.DistanceTo(b) < testTolerance
+}
+
+func pathLength(segs []Segment) float64 {
+	var l float64
+	for _, seg := range segs {
+		l += seg.Length()
+	}
+	return l
+}
+
+func TestBulgeSegment(t *testing.T) {
+	tests := []struct {
+		name   string
+		bulge  float64
+		kind   SegmentKind
+		center vector2.Vector2
+		mid    vector2.Vector2 // the point halfway along
+	}{
+		{"line", 0, SegmentLine, vector2.Zero(), vector2.New(1, 0)},
+		{"counter-clockwise half circle", 1, SegmentArc, vector2.New(1, 0), vector2.New(1, -1)},
+		{"clockwise half circle", -1, SegmentArc, vector2.New(1, 0), vector2.New(1, 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seg := BulgeSegment(vector2.Zero(), vector2.New(2, 0), tt.bulge)
+			if seg.Kind != tt.kind {
+				t.Fatalf("kind = %v, want %v", seg.Kind, tt.kind)
+			}
+			if tt.kind == SegmentArc && !near(seg.Center, tt.center) {
+				t.Errorf("center = %v, want %v", seg.Center, tt.center)
+			}
+			if got := seg.PointAt(seg.Length() * 0.5); !near(got, tt.mid) {
+				t.Errorf("midpoint = %v, want %v", got, tt.mid)
+			}
+			if math.Abs(seg.Bulge()-tt.bulge) > testTolerance {
+				t.Errorf("bulge = %v, want %v", seg.Bulge(), tt.bulge)
+			}
+		})
+	}
+}
+
+// hook is a line along X followed by a quarter turn to the left.
+func hook() *Path {
+	return NewPathFromSegments(false,
+		NewLine(vector2.Zero(), vector2.New(2, 0)),
+		NewArcSegment(vector2.New(2, 1), vector2.New(2, 0), math.Pi/2),
+	).Densify(ArcTolerance)
+}
+
+func TestPathSplit(t *testing.T) {
+	p := hook()
+	total := p.Length()
+	tests := []struct {
+		name string
+		d    float64
+		at   vector2.Vector2
+	}{
+		{"on the line", 1, vector2.New(1, 0)},
+		{"at the joint", 2, vector2.New(2, 0)},
+		{"on the arc", 2 + math.Pi/4, vector2.New(2+math.Sqrt2/2, 1-math.Sqrt2/2)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.PointAt(tt.d); !near(got, tt.at) {
+				t.Errorf("PointAt = %v, want %v", got, tt.at)
+			}
+			before, after := p.Split(tt.d)
+			if !near(before.Segments[len(before.Segments)-1].End, tt.at) || !near(after.Segments[0].Start, tt.at) {
+				t.Errorf("split at %v and %v, want %v", before.Segments[len(before.Segments)-1].End, after.Segments[0].Start, tt.at)
+			}
+			if l := pathLength(before.Segments) + pathLength(after.Segments); math.Abs(l-total) > testTolerance {
+				t.Errorf("pieces are %v long, want %v", l, total)
+			}
+			if math.Abs(pathLength(before.Segments)-tt.d) > testTolerance {
+				t.Errorf("before is %v long, want %v", pathLength(before.Segments), tt.d)
+			}
+		})
+	}
+}
+
+func TestPathTransformed(t *testing.T) {
+	p := hook()
+	tests := []struct {
+		name    string
+		xform   transform2d.Transform2D
+		reflect bool
+	}{
+		{"rotate", transform2d.NewTransform2D(math.Pi/3, vector2.New(5, -2)), false},
+		{"mirror in X", transform2d.Transform2DFromColumns(vector2.New(-1, 0), vector2.New(0, 1), vector2.New(5, 0)), true},
+		{"mirror in Y", transform2d.Transform2DFromColumns(vector2.New(1, 0), vector2.New(0, -1), vector2.Zero()), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			moved := p.Transformed(tt.xform)
+			arc := moved.Segments[1]
+			if arc.Kind != SegmentArc || (arc.Sweep < 0) != tt.reflect {
+				t.Errorf("arc sweeps %v, want it turned the other way: %v", arc.Sweep, tt.reflect)
+			}
+			for _, d := range []float64{0, 1, 2.5, p.Length()} {
+				if got, want := moved.PointAt(d), tt.xform.Xform(p.PointAt(d)); !near(got, want) {
+					t.Errorf("PointAt(%v) = %v, want %v", d, got, want)
+				}
+				want := tt.xform.Xform(p.TangentAt(d)).Sub(tt.xform.Xform(vector2.Zero()))
+				if got := moved.TangentAt(d); !near(got, want) {
+					t.Errorf("TangentAt(%v) = %v, want %v", d, got, want)
+				}
+			}
+
+			// splitting commutes with moving
+			before, _ := moved.Split(2.5)
+			origBefore, _ := p.Split(2.5)
+			if got, want := before.Segments[len(before.Segments)-1].End, tt.xform.Xform(origBefore.Segments[len(origBefore.Segments)-1].End); !near(got, want) {
+				t.Errorf("split moved path at %v, want %v", got, want)
+			}
+		})
+	}
+}
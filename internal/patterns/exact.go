@@ -0,0 +1,142 @@
+package patterns
+
+import (
+	"math/bits"
+	"sort"
+	"time"
+)
+
+// DefaultCoverBudget is the time ExactCoverageIndex is given by the drill planners before they settle
+// for the best cover found so far.
+const DefaultCoverBudget = 200 * time.Millisecond
+
+// coverCheckInterval is the number of search nodes visited between checks of the time budget.
+const coverCheckInterval = 1024
+
+// bitset is a set of element ids.
+type bitset []uint64
+
+func newBitset(n int) bitset {
+	return make(bitset, (n+63)/64)
+}
+
+func (b bitset) set(i int) {
+	b[i/64] |= 1 << uint(i%64)
+}
+
+func (b bitset) has(i int) bool {
+	return b[i/64]&(1<<uint(i%64)) != 0
+}
+
+func (b bitset) union(o bitset) bitset {
+	res := make(bitset, len(b))
+	for i := range b {
+		res[i] = b[i] | o[i]
+	}
+	return res
+}
+
+// count returns the number of elements of o that aren't in b.
+func (b bitset) count(o bitset) int {
+	n := 0
+	for i := range b {
+		n += bits.OnesCount64(o[i] &^ b[i])
+	}
+	return n
+}
+
+// coverSearch is the state of a branch and bound search for a smallest cover.
+type coverSearch struct {
+	sets     []bitset
+	covering [][]int // the sets holding each element
+	size     int     // the number of elements
+	largest  int     // the size of the largest set
+	best     []int
+	nodes    int
+	deadline time.Time
+	expired  bool
+}
+
+// ExactCoverageIndex returns the indices of a smallest set of sets that covers the whole universe,
+// searching by branch and bound from the greedy cover. If the search runs past the budget it
+// returns the smallest cover found so far, which is never larger than the greedy one.
+func ExactCoverageIndex(s [][]int, budget time.Duration) []int {
+	greedy := GreedyCoverageIndex(s)
+
+	// number the elements densely so they fit a bitset
+	ids := make(map[int]int)
+	for _, rawSet := range s {
+		for _, element := range rawSet {
+			if _, ok := ids[element]; !ok {
+				ids[element] = len(ids)
+			}
+		}
+	}
+	search := coverSearch{
+		sets:     make([]bitset, len(s)),
+		covering: make([][]int, len(ids)),
+		size:     len(ids),
+		best:     greedy,
+		deadline: time.Now().Add(budget),
+	}
+	for i, rawSet := range s {
+		search.sets[i] = newBitset(len(ids))
+		for _, element := range rawSet {
+			if !search.sets[i].has(ids[element]) {
+				search.sets[i].set(ids[element])
+				search.covering[ids[element]] = append(search.covering[ids[element]], i)
+			}
+		}
+		search.largest = max(search.largest, newBitset(len(ids)).count(search.sets[i]))
+	}
+	if search.largest == 0 {
+		return greedy
+	}
+
+	search.branch(newBitset(len(ids)), nil, 0)
+	return search.best
+}
+
+// branch extends the cover chosen so far, which covers the covered elements, by each set holding
+// the uncovered element fewest sets hold, and records covers smaller than the best.
+func (cs *coverSearch) branch(covered bitset, chosen []int, count int) {
+	if cs.expired {
+		return
+	}
+	// the first node checks too, so a spent budget settles for the greedy cover without searching
+	if cs.nodes++; cs.nodes%coverCheckInterval == 1 && time.Now().After(cs.deadline) {
+		cs.expired = true
+		return
+	}
+	if count == cs.size {
+		if len(chosen) < len(cs.best) {
+			cs.best = append([]int(nil), chosen...)
+		}
+		return
+	}
+	// even the largest sets can't finish the cover with fewer sets than the best
+	remaining := cs.size - count
+	if len(chosen)+(remaining+cs.largest-1)/cs.largest >= len(cs.best) {
+		return
+	}
+
+	element := -1
+	for e := 0; e < cs.size; e++ {
+		if !covered.has(e) && (element < 0 || len(cs.covering[e]) < len(cs.covering[element])) {
+			element = e
+		}
+	}
+
+	// try the sets covering the most first, so good covers are found early
+	options := append([]int(nil), cs.covering[element]...)
+	gain := make(map[int]int, len(options))
+	for _, i := range options {
+		gain[i] = covered.count(cs.sets[i])
+	}
+	sort.SliceStable(options, func(a, b int) bool {
+		return gain[options[a]] > gain[options[b]]
+	})
+	for _, i := range options {
+		cs.branch(covered.union(cs.sets[i]), append(chosen, i), count+gain[i])
+	}
+}
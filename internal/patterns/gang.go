@@ -0,0 +1,143 @@
+package patterns
+
+import (
+	"math"
+
+	"github.com/029614/gcode_lang/internal/data"
+)
+
+// MillimetresToInches converts the router's gang slot offsets, which are given in millimetres, to
+// the inches the nest is drawn in.
+const MillimetresToInches = 1 / 25.4
+
+// GangTolerance is the largest distance between a bit and a hole, and between a bit's diameter and
+// a hole's, for the bit to drill the hole. It allows for 32mm system holes being drawn on 1.2598"
+// centres while the gang head is built on 1.26" ones.
+const GangTolerance = 0.005
+
+// GangSlot is a loaded bit of the gang drill.
+type GangSlot struct {
+	Index    int        // the slot number, from 1
+	Offset   [2]float64 // the bit's position relative to slot 1, in inches
+	Diameter float64    // the cut diameter of the bit
+}
+
+// GangHole is a hole to drill with the gang head.
+type GangHole struct {
+	Position [2]float64
+	Diameter float64
+}
+
+// GangHit is a single plunge of the gang head.
+type GangHit struct {
+	Position [2]float64 // where slot 1 is over, which the other bits are offset from
+	Mask     uint32     // the slots that drop, bit 0 being slot 1
+	Holes    []int      // the indices of the holes drilled
+}
+
+// GetGangSlots returns the loaded slots of the router's gang drill. Slots without a tool, or with a
+// tool that isn't in the library, are left out.
+func GetGangSlots(router *data.Router, tools *data.ToolLibrary) []GangSlot {
+	var slots []GangSlot
+	if router == nil || tools == nil {
+		return slots
+	}
+	for idx := 1; idx <= data.GangSlotCount; idx++ {
+		gs := router.GetGangSlot(idx)
+		if gs.ToolID == "" {
+			continue
+		}
+		tool, err := tools.GetToolByID(gs.ToolID)
+		if err != nil {
+			continue
+		}
+		slots = append(slots, GangSlot{
+			Index:    idx,
+			Offset:   [2]float64{gs.OffsetX * MillimetresToInches, gs.OffsetY * MillimetresToInches},
+			Diameter: tool.CutDiameter,
+		})
+	}
+	return slots
+}
+
+// PlanGangHits returns a small set of gang hits that drills every hole a loaded bit fits. A hit only
+// drops the bits that land on a hole of their diameter, so nothing but holes is drilled, and no hole
+// is drilled twice. It also returns the indices of the holes no bit fits.
+func PlanGangHits(holes []GangHole, slots []GangSlot) ([]GangHit, []int) {
+	candidates := getGangCandidates(holes, slots)
+	sets := make([][]int, len(candidates))
+	for i, c := range candidates {
+		sets[i] = c.holes
+	}
+
+	var hits []GangHit
+	drilled := make(map[int]struct{})
+	for _, idx := range ExactCoverageIndex(sets, DefaultCoverBudget) {
+		c := candidates[idx]
+		hit := GangHit{Position: c.position}
+		for i, hole := range c.holes {
+			if _, ok := drilled[hole]; ok {
+				continue
+			}
+			drilled[hole] = struct{}{}
+			hit.Holes = append(hit.Holes, hole)
+			hit.Mask |= 1 << uint(c.slots[i]-1)
+		}
+		if hit.Mask != 0 {
+			hits = append(hits, hit)
+		}
+	}
+
+	var missed []int
+	for i := range holes {
+		if _, ok := drilled[i]; !ok {
+			missed = append(missed, i)
+		}
+	}
+	return hits, missed
+}
+
+// gangCandidate is a position of the gang head and the holes its bits land on there.
+type gangCandidate struct {
+	position [2]float64
+	holes    []int
+	slots    []int // the slot drilling each hole
+}
+
+// getGangCandidates returns every head position that puts a bit over a hole of its diameter, with all
+// of the holes the head's bits land on there.
+func getGangCandidates(holes []GangHole, slots []GangSlot) []gangCandidate {
+	positions := make([][2]float64, len(holes))
+	for i, hole := range holes {
+		positions[i] = hole.Position
+	}
+	hash := newPointHash(positions, GangTolerance)
+	origins := newPointHash(nil, GangTolerance)
+
+	var candidates []gangCandidate
+	for _, hole := range holes {
+		for _, slot := range slots {
+			if math.Abs(slot.Diameter-hole.Diameter) > GangTolerance {
+				continue
+			}
+			pos := sub(hole.Position, slot.Offset)
+			if origins.find(pos, GangTolerance*0.1, nil) >= 0 {
+				continue
+			}
+			origins.add(pos)
+
+			c := gangCandidate{position: pos}
+			for _, s := range slots {
+				j := hash.find(add(pos, s.Offset), GangTolerance, func(i int) bool {
+					return math.Abs(holes[i].Diameter-s.Diameter) <= GangTolerance
+				})
+				if j >= 0 {
+					c.holes = append(c.holes, j)
+					c.slots = append(c.slots, s.Index)
+				}
+			}
+			candidates = append(candidates, c)
+		}
+	}
+	return candidates
+}
@@ -0,0 +1,49 @@
+package patterns
+
+import "math"
+
+// pointHash buckets points into a grid of square cells so the points near a position can be found
+// without visiting them all.
+type pointHash struct {
+	cell   float64
+	points [][2]float64
+	cells  map[[2]int][]int
+}
+
+// newPointHash indexes the points in cells of the size, which should be at least the largest
+// distance looked up.
+func newPointHash(points [][2]float64, cell float64) *pointHash {
+	h := &pointHash{cell: cell, cells: make(map[[2]int][]int)}
+	for _, pt := range points {
+		h.add(pt)
+	}
+	return h
+}
+
+// add indexes another point.
+func (h *pointHash) add(pt [2]float64) {
+	key := h.key(pt)
+	h.cells[key] = append(h.cells[key], len(h.points))
+	h.points = append(h.points, pt)
+}
+
+func (h *pointHash) key(pt [2]float64) [2]int {
+	return [2]int{int(math.Floor(pt[0] / h.cell)), int(math.Floor(pt[1] / h.cell))}
+}
+
+// find returns the index of a point within tolerance of pos that accept allows, or -1 if there is
+// none. A nil accept allows every point. The tolerance must not exceed the cell size.
+func (h *pointHash) find(pos [2]float64, tolerance float64, accept func(int) bool) int {
+	key := h.key(pos)
+	for dx := -1; dx <= 1; dx++ {
+		for dy := -1; dy <= 1; dy++ {
+			for _, i := range h.cells[[2]int{key[0] + dx, key[1] + dy}] {
+				pt := h.points[i]
+				if math.Hypot(pt[0]-pos[0], pt[1]-pos[1]) <= tolerance && (accept == nil || accept(i)) {
+					return i
+				}
+			}
+		}
+	}
+	return -1
+}
@@ -1,6 +1,6 @@
 package patterns
 
-import "sort"
+import "time"
 
 // set holds the original set elements but also
 // a map of elements that are not yet covered in the resulting universe.
@@ -38,21 +38,22 @@ func GreedyCoverageIndex(s [][]int) (resultIndex []int) {
 		sets[i] = newSet(rawSet, i)
 	}
 	for {
-		// search for the set that covers most elements in the universe
-		sort.Slice(sets, func(i, j int) bool {
-			if len(sets[i].uncoveredElements) == len(sets[j].uncoveredElements) {
-				return len(sets[i].elements) < len(sets[j].elements)
+		// search for the set that covers most elements in the universe, preferring smaller sets
+		biggest := -1
+		for i, set := range sets {
+			if biggest < 0 || len(set.uncoveredElements) > len(sets[biggest].uncoveredElements) ||
+				len(set.uncoveredElements) == len(sets[biggest].uncoveredElements) && len(set.elements) < len(sets[biggest].elements) {
+				biggest = i
 			}
-			return len(sets[i].uncoveredElements) > len(sets[j].uncoveredElements)
-		})
-		if len(sets) == 0 || len(sets[0].uncoveredElements) == 0 {
+		}
+		if biggest < 0 || len(sets[biggest].uncoveredElements) == 0 {
 			// no more sets or elements in sets -> universe is now covered in result
 			return
 		}
 		// add the biggest set to the universe and remove it from the remaining sets
-		biggestSet := sets[0]
+		biggestSet := sets[biggest]
 		resultIndex = append(resultIndex, biggestSet.index)
-		sets = sets[1:]
+		sets = append(sets[:biggest], sets[biggest+1:]...)
 		// remove elements of the biggest set from the remaining sets
 		for i, set := range sets {
 			set.filter(biggestSet.uncoveredElements)
@@ -62,7 +63,16 @@ func GreedyCoverageIndex(s [][]int) (resultIndex []int) {
 }
 
 func GreedyCoverage(s [][]int) (result [][]int) {
-	indices := GreedyCoverageIndex(s)
+	return coverage(s, GreedyCoverageIndex(s))
+}
+
+// ExactCoverage returns the smallest set of sets that covers the whole universe, or the smallest
+// found within the budget. See ExactCoverageIndex.
+func ExactCoverage(s [][]int, budget time.Duration) (result [][]int) {
+	return coverage(s, ExactCoverageIndex(s, budget))
+}
+
+func coverage(s [][]int, indices []int) (result [][]int) {
 	result = make([][]int, len(indices))
 	for i, index := range indices {
 		result[i] = make([]int, len(s[index]))
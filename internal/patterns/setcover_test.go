@@ -0,0 +1,169 @@
+package patterns
+
+import (
+	"encoding/json"
+	"math/rand"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// bruteCover returns the size of the smallest cover of the sets, trying every subset.
+func bruteCover(s [][]int) int {
+	universe := make(map[int]struct{})
+	for _, rawSet := range s {
+		for _, e := range rawSet {
+			universe[e] = struct{}{}
+		}
+	}
+	best := len(s)
+	for mask := 0; mask < 1<<len(s); mask++ {
+		covered := make(map[int]struct{})
+		count := 0
+		for i := range s {
+			if mask&(1<<i) != 0 {
+				count++
+				for _, e := range s[i] {
+					covered[e] = struct{}{}
+				}
+			}
+		}
+		if len(covered) == len(universe) && count < best {
+			best = count
+		}
+	}
+	return best
+}
+
+// isCover reports whether the chosen sets hold every element of the sets.
+func isCover(s [][]int, chosen []int) bool {
+	covered := make(map[int]struct{})
+	for _, i := range chosen {
+		for _, e := range s[i] {
+			covered[e] = struct{}{}
+		}
+	}
+	for _, rawSet := range s {
+		for _, e := range rawSet {
+			if _, ok := covered[e]; !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// greedyTrap is covered by its last two sets, but greedy takes the largest first and needs all three.
+var greedyTrap = [][]int{{1, 2, 3, 4}, {1, 2, 5}, {3, 4, 6}}
+
+func TestExactCoverageIndex(t *testing.T) {
+	tests := []struct {
+		name string
+		sets [][]int
+	}{
+		{"empty", nil},
+		{"single", [][]int{{1, 2, 3}}},
+		{"disjoint", [][]int{{1}, {2}, {3}}},
+		{"nested", [][]int{{1}, {1, 2}, {1, 2, 3}}},
+		{"greedy trap", greedyTrap},
+		{"rows and columns", [][]int{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}, {1, 4, 7}, {2, 5, 8}, {3, 6, 9}, {1, 5, 9}}},
+	}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 40; i++ {
+		sets := make([][]int, 3+rng.Intn(8))
+		for j := range sets {
+			for e := 0; e < 12; e++ {
+				if rng.Intn(4) == 0 {
+					sets[j] = append(sets[j], e)
+				}
+			}
+		}
+		tests = append(tests, struct {
+			name string
+			sets [][]int
+		}{"random", sets})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ExactCoverageIndex(tt.sets, time.Minute)
+			if !isCover(tt.sets, got) {
+				t.Fatalf("%v does not cover %v", got, tt.sets)
+			}
+			if want := bruteCover(tt.sets); len(got) != want {
+				t.Errorf("cover %v has %d sets, want %d", got, len(got), want)
+			}
+		})
+	}
+}
+
+func TestExactCoverageIndexBudget(t *testing.T) {
+	greedy := GreedyCoverageIndex(greedyTrap)
+	if len(greedy) != 3 {
+		t.Fatalf("greedy cover %v, want the trap to take 3 sets", greedy)
+	}
+	if got := ExactCoverageIndex(greedyTrap, -time.Second); !reflect.DeepEqual(got, greedy) {
+		t.Errorf("spent budget gave %v, want the greedy cover %v", got, greedy)
+	}
+}
+
+// caseworkHoles returns the holes of the casework parts, each part's laid beside the last.
+func caseworkHoles(b *testing.B) [][2]float64 {
+	var raw struct {
+		Parts []struct {
+			Size struct {
+				X float64 `json:"x"`
+			} `json:"size"`
+			Geometry struct {
+				Arcs []struct {
+					Geometry struct {
+						Position struct {
+							X float64 `json:"x"`
+							Y float64 `json:"y"`
+						} `json:"position"`
+					} `json:"geometry"`
+				} `json:"Arcs"`
+			} `json:"geometry"`
+		} `json:"parts"`
+	}
+	data, err := os.ReadFile("../../tests/sawboxtestingCasework/output/PartOutput_casework_parts.json")
+	if err != nil {
+		b.Skip(err)
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		b.Fatal(err)
+	}
+	var holes [][2]float64
+	x := 0.0
+	for _, part := range raw.Parts {
+		for _, arc := range part.Geometry.Arcs {
+			holes = append(holes, [2]float64{x + arc.Geometry.Position.X, arc.Geometry.Position.Y})
+		}
+		x += part.Size.X + 1
+	}
+	if len(holes) == 0 {
+		b.Skip("no casework holes")
+	}
+	return holes
+}
+
+// caseworkPattern is three bits of the 32mm line boring gang.
+var caseworkPattern = [][2]float64{{0, 0}, {32 * MillimetresToInches, 0}, {64 * MillimetresToInches, 0}}
+
+func BenchmarkSetCover(b *testing.B) {
+	holes := caseworkHoles(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		SetCover(append([][2]float64(nil), holes...), caseworkPattern)
+	}
+}
+
+func BenchmarkExactCoverageIndex(b *testing.B) {
+	holes := caseworkHoles(b)
+	permutations := getPermutations(sortPoints(holes), sortPoints(append([][2]float64(nil), caseworkPattern...)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ExactCoverageIndex(permutations, DefaultCoverBudget)
+	}
+}
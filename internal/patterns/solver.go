@@ -5,6 +5,12 @@ import (
 	"sort"
 )
 
+// patternTolerance is the distance within which a pattern point lands on a point of the universe.
+const patternTolerance = 0.0001
+
+// patternCellSize is the cell size of the spatial hashes the pattern points are looked up in.
+const patternCellSize = 0.01
+
 // SetCover calculates the smallest set of drill patterns that cover all points in the universe.
 func SetCover(universe [][2]float64, pattern [][2]float64) [][][2]float64 {
 	// Sort the universe by X and then by Y
@@ -17,7 +23,7 @@ func SetCover(universe [][2]float64, pattern [][2]float64) [][][2]float64 {
 	permutations := getPermutations(universe, pattern)
 
 	// Use the set cover algorithm to reduce the permutations to the smallest set that covers the universe
-	solution := GreedyCoverage(permutations)
+	solution := ExactCoverage(permutations, DefaultCoverBudget)
 	var result [][][2]float64
 
 	// Return the values of the smallest set
@@ -45,33 +51,28 @@ func sortPoints(slice [][2]float64) [][2]float64 {
 }
 
 // getPermutations creates a slice of indices for the permutations of the pattern that can cover the universe.
+// Each permutation places the pattern so one of its points lands on a point of the universe, and holds
+// every point of the universe the pattern's points land on there.
 func getPermutations(universe [][2]float64, pattern [][2]float64) [][]int {
 	var permutations [][]int
-
-	//var uOffset [2]float64
-	//var uOrigin [2]float64
+	hash := newPointHash(universe, patternCellSize)
+	origins := newPointHash(nil, patternCellSize)
 
 	for _, iPat := range pattern {
-		for i, iPoint := range universe {
-			// permutation increment
-			//uOffset = add(iPoint, iPat)
-			//uOrigin = getOrigin(iPoint, uOffset)
-			perm := []int{i}
+		for _, iPoint := range universe {
+			uOrigin := getOrigin(iPoint, iPat)
+			if origins.find(uOrigin, patternTolerance, nil) >= 0 {
+				// the same placement was already reached from another pair of points
+				continue
+			}
+			origins.add(uOrigin)
 
+			var perm []int
 			for _, jPat := range pattern {
-				if isEqualApprox(jPat, iPat) {
-					continue
-				}
-				for j, jPoint := range universe {
-					if isEqualApprox(jPoint, iPoint) {
-						continue
-					}
-					if canCover(jPoint, add(jPat, iPoint)) {
-						perm = append(perm, j)
-					}
+				if j := hash.find(getGlobal(uOrigin, jPat), patternTolerance, nil); j >= 0 {
+					perm = append(perm, j)
 				}
 			}
-
 			permutations = append(permutations, perm)
 		}
 	}
@@ -86,7 +87,7 @@ func canCover(point [2]float64, patternPoint [2]float64) bool {
 }
 
 func isEqualApproxF(a, b float64) bool {
-	return math.Abs(a-b) < 0.0001
+	return math.Abs(a-b) < patternTolerance
 }
 
 func isEqualApprox(a, b [2]float64) bool {
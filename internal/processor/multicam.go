@@ -1,7 +1,7 @@
 package processor
 
 import (
-	"github.com/029614/gcode_lang/pkg/data"
+	"github.com/029614/gcode_lang/internal/data"
 	"github.com/029614/gcode_lang/pkg/scode"
 )
 
@@ -13,8 +13,9 @@ type MulticamProcessor struct {
 
 func NewMulticamProcessor(router *data.Router, tools *data.ToolLibrary) *MulticamProcessor {
 	return &MulticamProcessor{
-		Router: router,
-		Tools:  tools,
+		ProcessorBase: ProcessorBase{Subprograms: router != nil && router.Subprograms},
+		Router:        router,
+		Tools:         tools,
 	}
 }
 
@@ -105,11 +106,19 @@ func (mp *MulticamProcessor) PostProcessToken(token *scode.Token) {
 		token.Identifier = "G03"
 	case scode.ID_ARC_CW_2D:
 		token.Identifier = "G02"
+	case scode.ID_SUBPROGRAM_CALL:
+		// Multicam calls subroutines with G98, as the end code calls P147
+		token.Identifier = "G98"
+	default:
+		mp.ProcessorBase.PostProcessToken(token)
 	}
 }
 
 // dereferencing hell, but it works.
 func (pb *MulticamProcessor) PostProcess(ot *scode.OperationTree) {
+	if pb.Subprograms {
+		ExtractSubprograms(ot)
+	}
 	for _, op := range *ot {
 		for _, com := range op.Commands {
 			for _, ins := range com.Instructions {
@@ -0,0 +1,81 @@
+package processor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/029614/gcode_lang/internal/data"
+	"github.com/029614/gcode_lang/pkg/scode"
+	"github.com/Anaxarchus/zero-gdscript/pkg/vector2"
+)
+
+// postedLines returns the lines of the posted script, trimmed, without the blank ones.
+func postedLines(ot *scode.OperationTree) []string {
+	var lines []string
+	for _, line := range strings.Split(ot.GetScript(), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func indexOf(lines []string, line string) int {
+	for i, l := range lines {
+		if l == line {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestMulticamSubprograms(t *testing.T) {
+	tests := []struct {
+		name        string
+		subprograms bool
+		want        []string // lines posted in this order
+		absent      []string
+	}{
+		{"called", true,
+			[]string{
+				"G52 X5.000000 Y5.000000", "G98 P1000", "G52 X0 Y0",
+				"G52 X20.000000 Y3.000000", "G98 P1000", "G52 X0 Y0",
+				"M02",
+				"O1000", "G00 X0.000000 Y0.000000", "G01 X2.000000 Y0.000000", "G01 X2.000000 Y1.000000", "M99",
+			},
+			[]string{"M98 P1000"}},
+		{"inline", false,
+			[]string{"G00 X5.000000 Y5.000000", "G00 X20.000000 Y3.000000", "M02"},
+			[]string{"G98 P1000", "O1000", "M99"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ot := scode.NewOperationTree(scode.NewOperation(scode.OT_START, scode.NewCommand(scode.CT_START)))
+			ot.AddOperation(
+				partOperation(placed(notch, 0, vector2.New(5, 5))...),
+				partOperation(placed(notch, 0, vector2.New(20, 3))...),
+				scode.NewOperation(scode.OT_END, scode.NewCommand(scode.CT_STOP)),
+			)
+			NewMulticamProcessor(&data.Router{Subprograms: tt.subprograms}, nil).PostProcess(ot)
+
+			lines := postedLines(ot)
+			at := 0
+			for _, want := range tt.want {
+				i := indexOf(lines[at:], want)
+				if i < 0 {
+					t.Fatalf("%q isn't posted after line %d of\n%s", want, at, strings.Join(lines, "\n"))
+				}
+				at += i + 1
+			}
+			for _, line := range tt.absent {
+				if indexOf(lines, line) >= 0 {
+					t.Errorf("%q is posted in\n%s", line, strings.Join(lines, "\n"))
+				}
+			}
+			// the definitions follow the end of the main program, which the controller stops at
+			if tt.subprograms && lines[len(lines)-1] != "M99" {
+				t.Errorf("posted ends with %q, want the end of the last subprogram", lines[len(lines)-1])
+			}
+		})
+	}
+}
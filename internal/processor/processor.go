@@ -2,15 +2,37 @@ package processor
 
 import "github.com/029614/gcode_lang/pkg/scode"
 
-type ProcessorBase struct{}
+type ProcessorBase struct {
+	// Subprograms enables emitting repeated parts once as a subprogram and calling it per part.
+	Subprograms bool
+}
 
 func (pb *ProcessorBase) PostProcessOperation(operation *scode.Operation)       {}
 func (pb *ProcessorBase) PostProcessCommand(command *scode.Command)             {}
 func (pb *ProcessorBase) PostProcessInstruction(instruction *scode.Instruction) {}
-func (pb *ProcessorBase) PostProcessToken(token *scode.Token)                   {}
 func (pb *ProcessorBase) PostProcessHandleDrill(operation *scode.Operation)     {}
 
+func (pb *ProcessorBase) PostProcessToken(token *scode.Token) {
+	switch token.Identifier {
+	case scode.ID_SUBPROGRAM:
+		token.Identifier = "O"
+	case scode.ID_SUBPROGRAM_END:
+		token.Identifier = "M99"
+	case scode.ID_SUBPROGRAM_CALL:
+		token.Identifier = "M98"
+	case scode.ID_LOCAL_ORIGIN:
+		token.Identifier = "G52"
+	case scode.ID_ROTATE:
+		token.Identifier = "G68"
+	case scode.ID_ROTATE_END:
+		token.Identifier = "G69"
+	}
+}
+
 func (pb *ProcessorBase) PostProcess(ot *scode.OperationTree) {
+	if pb.Subprograms {
+		ExtractSubprograms(ot)
+	}
 	for _, op := range *ot {
 		for _, com := range op.Commands {
 			for _, ins := range com.Instructions {
@@ -0,0 +1,264 @@
+package processor
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/029614/gcode_lang/pkg/scode"
+	"github.com/Anaxarchus/zero-gdscript/pkg/vector2"
+)
+
+// SubprogramStart is the first program number handed out to extracted subprograms.
+// It is kept well clear of the controller macros (P147, P300).
+const SubprogramStart = 1000
+
+const subprogramTolerance = 0.0001
+
+// motion is an instruction of a part broken into its geometric and non-geometric parts.
+type motion struct {
+	tokens    []*scode.Token // non-geometric tokens, in order
+	position  vector2.Vector2
+	center    vector2.Vector2
+	hasXY     bool
+	hasCenter bool
+}
+
+type partShape struct {
+	op      *scode.Operation
+	motions []motion
+	anchor  vector2.Vector2
+}
+
+type partInstance struct {
+	shape    *partShape
+	rotation int // multiple of 90 degrees
+}
+
+type partGroup struct {
+	reference *partShape
+	instances []partInstance
+}
+
+// ExtractSubprograms finds OT_PART operations that share the same toolpath up to translation
+// or a 90 degree rotation. Each repeated toolpath is moved into an OT_SUBPROGRAM definition
+// appended to the tree, after the program's end so it only runs when called, written about the
+// part's first position, and every part using it is
+// replaced by a call that moves the origin of the coordinates there and rotates them to the part,
+// for the subprogram's length only. It returns the number of subprograms created.
+func ExtractSubprograms(ot *scode.OperationTree) int {
+	var groups []*partGroup
+
+	for _, op := range *ot {
+		if op.Type != scode.OT_PART {
+			continue
+		}
+		shape := newPartShape(op)
+		if len(shape.motions) == 0 {
+			continue
+		}
+
+		matched := false
+		for _, g := range groups {
+			if rot, ok := matchShape(g.reference, shape); ok {
+				g.instances = append(g.instances, partInstance{shape: shape, rotation: rot})
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			groups = append(groups, &partGroup{
+				reference: shape,
+				instances: []partInstance{{shape: shape}},
+			})
+		}
+	}
+
+	count := 0
+	for _, g := range groups {
+		if len(g.instances) < 2 {
+			continue
+		}
+		number := fmt.Sprintf("%d", SubprogramStart+count)
+		ot.AddOperation(newSubprogramOperation(g.reference, number))
+		for _, inst := range g.instances {
+			inst.shape.op.Commands = []*scode.Command{newSubprogramCall(inst, number)}
+		}
+		count++
+	}
+	return count
+}
+
+func newPartShape(op *scode.Operation) *partShape {
+	shape := &partShape{op: op}
+	var pos vector2.Vector2
+	anchored := false
+
+	for _, com := range op.Commands {
+		for _, ins := range com.Instructions {
+			m := motion{}
+			for _, tok := range ins.Tokens {
+				switch tok.Identifier {
+				case scode.ID_PARAMETER_X:
+					pos.X = parseValue(tok.Value)
+					m.hasXY = true
+				case scode.ID_PARAMETER_Y:
+					pos.Y = parseValue(tok.Value)
+					m.hasXY = true
+				case scode.ID_PARAMETER_I:
+					m.center.X = parseValue(tok.Value)
+					m.hasCenter = true
+				case scode.ID_PARAMETER_J:
+					m.center.Y = parseValue(tok.Value)
+					m.hasCenter = true
+				default:
+					m.tokens = append(m.tokens, tok)
+				}
+			}
+			m.position = pos
+			if m.hasXY && !anchored {
+				shape.anchor = pos
+				anchored = true
+			}
+			shape.motions = append(shape.motions, m)
+		}
+	}
+
+	if !anchored {
+		shape.motions = nil
+	}
+	return shape
+}
+
+// matchShape checks whether b is a, translated and rotated by a multiple of 90 degrees.
+func matchShape(a, b *partShape) (int, bool) {
+	if len(a.motions) != len(b.motions) {
+		return 0, false
+	}
+	for rot := 0; rot < 4; rot++ {
+		if shapesEqual(a, b, rot) {
+			return rot, true
+		}
+	}
+	return 0, false
+}
+
+func shapesEqual(a, b *partShape, rot int) bool {
+	for i := range a.motions {
+		ma, mb := a.motions[i], b.motions[i]
+		if ma.hasXY != mb.hasXY || ma.hasCenter != mb.hasCenter || len(ma.tokens) != len(mb.tokens) {
+			return false
+		}
+		for j := range ma.tokens {
+			if ma.tokens[j].Identifier != mb.tokens[j].Identifier || ma.tokens[j].Value != mb.tokens[j].Value {
+				return false
+			}
+		}
+		if ma.hasXY && !isEqualApprox(rotateQuarter(ma.position.Sub(a.anchor), rot), mb.position.Sub(b.anchor)) {
+			return false
+		}
+		// arc centres are given from the arc's start, so only turn with the part
+		if ma.hasCenter && !isEqualApprox(rotateQuarter(ma.center, rot), mb.center) {
+			return false
+		}
+	}
+	return true
+}
+
+func newSubprogramOperation(shape *partShape, number string) *scode.Operation {
+	op := scode.NewOperation(scode.OT_SUBPROGRAM)
+	com := op.NewCommand(scode.CT_SUBPROGRAM)
+	com.NewInstruction(scode.NewToken(scode.ID_SUBPROGRAM, number))
+
+	for _, m := range shape.motions {
+		ins := com.NewInstruction()
+		// keep geometric parameters directly after the code token, as they were emitted
+		for i, tok := range m.tokens {
+			ins.AddToken(tok)
+			if i == 0 {
+				addLocalParameters(ins, m, shape.anchor)
+			}
+		}
+		if len(m.tokens) == 0 {
+			addLocalParameters(ins, m, shape.anchor)
+		}
+	}
+
+	com.NewInstruction(scode.NewToken(scode.ID_SUBPROGRAM_END, ""))
+	return op
+}
+
+func addLocalParameters(ins *scode.Instruction, m motion, anchor vector2.Vector2) {
+	if m.hasXY {
+		local := m.position.Sub(anchor)
+		ins.AddToken(
+			scode.NewToken(scode.ID_PARAMETER_X, fmt.Sprintf("%f", local.X)),
+			scode.NewToken(scode.ID_PARAMETER_Y, fmt.Sprintf("%f", local.Y)),
+		)
+	}
+	if m.hasCenter {
+		ins.AddToken(
+			scode.NewToken(scode.ID_PARAMETER_I, fmt.Sprintf("%f", m.center.X)),
+			scode.NewToken(scode.ID_PARAMETER_J, fmt.Sprintf("%f", m.center.Y)),
+		)
+	}
+}
+
+// newSubprogramCall returns the call of the subprogram for a part: the origin moved to the part's
+// anchor and the coordinates turned about it by the part's rotation around a plain call, and both
+// put back after it, as the call itself takes no position.
+func newSubprogramCall(inst partInstance, number string) *scode.Command {
+	com := scode.NewCommand(scode.CT_SUBPROGRAM_CALL)
+	com.NewInstruction(
+		scode.NewToken(scode.ID_LOCAL_ORIGIN, ""),
+		scode.NewToken(scode.ID_PARAMETER_X, fmt.Sprintf("%f", inst.shape.anchor.X)),
+		scode.NewToken(scode.ID_PARAMETER_Y, fmt.Sprintf("%f", inst.shape.anchor.Y)),
+	)
+	if inst.rotation != 0 {
+		com.NewInstruction(
+			scode.NewToken(scode.ID_ROTATE, ""),
+			scode.NewToken(scode.ID_PARAMETER_X, "0"),
+			scode.NewToken(scode.ID_PARAMETER_Y, "0"),
+			scode.NewToken(scode.ID_PARAMETER_R, fmt.Sprintf("%d", inst.rotation*90)),
+		)
+	}
+	com.NewInstruction(
+		scode.NewToken(scode.ID_SUBPROGRAM_CALL, ""),
+		scode.NewToken(scode.ID_PARAMETER_P, number),
+	)
+	if inst.rotation != 0 {
+		com.NewInstruction(scode.NewToken(scode.ID_ROTATE_END, ""))
+	}
+	com.NewInstruction(
+		scode.NewToken(scode.ID_LOCAL_ORIGIN, ""),
+		scode.NewToken(scode.ID_PARAMETER_X, "0"),
+		scode.NewToken(scode.ID_PARAMETER_Y, "0"),
+	)
+	return com
+}
+
+// rotateQuarter rotates v counter-clockwise by rot quarter turns without trigonometric error.
+func rotateQuarter(v vector2.Vector2, rot int) vector2.Vector2 {
+	switch rot % 4 {
+	case 1:
+		return vector2.New(-v.Y, v.X)
+	case 2:
+		return vector2.New(-v.X, -v.Y)
+	case 3:
+		return vector2.New(v.Y, -v.X)
+	default:
+		return v
+	}
+}
+
+func isEqualApprox(a, b vector2.Vector2) bool {
+	return math.Abs(a.X-b.X) < subprogramTolerance && math.Abs(a.Y-b.Y) < subprogramTolerance
+}
+
+func parseValue(value string) float64 {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0.0
+	}
+	return f
+}
@@ -0,0 +1,98 @@
+package processor
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/029614/gcode_lang/pkg/scode"
+	"github.com/Anaxarchus/zero-gdscript/pkg/vector2"
+)
+
+// partOperation returns an OT_PART operation cutting through the points.
+func partOperation(points ...vector2.Vector2) *scode.Operation {
+	com := scode.NewCommand(scode.CT_SPINDLEMOTION)
+	for i, pt := range points {
+		id := scode.ID_CUT
+		if i == 0 {
+			id = scode.ID_MOVE
+		}
+		com.NewInstruction(
+			scode.NewToken(id, ""),
+			scode.NewToken(scode.ID_PARAMETER_X, fmt.Sprintf("%f", pt.X)),
+			scode.NewToken(scode.ID_PARAMETER_Y, fmt.Sprintf("%f", pt.Y)),
+		)
+	}
+	return scode.NewOperation(scode.OT_PART, com)
+}
+
+// notch is an L shaped cut from the origin, so each of its quarter turns is different.
+var notch = []vector2.Vector2{vector2.New(0, 0), vector2.New(2, 0), vector2.New(2, 1)}
+
+func placed(points []vector2.Vector2, rot int, at vector2.Vector2) []vector2.Vector2 {
+	res := make([]vector2.Vector2, len(points))
+	for i, pt := range points {
+		res[i] = rotateQuarter(pt, rot).Add(at)
+	}
+	return res
+}
+
+func TestExtractSubprograms(t *testing.T) {
+	tests := []struct {
+		name     string
+		parts    [][]vector2.Vector2
+		count    int
+		rotation string // the R of the second part's call, or empty if it isn't rotated
+	}{
+		{"moved", [][]vector2.Vector2{placed(notch, 0, vector2.New(5, 5)), placed(notch, 0, vector2.New(20, 3))}, 1, ""},
+		{"turned", [][]vector2.Vector2{placed(notch, 0, vector2.New(5, 5)), placed(notch, 1, vector2.New(20, 3))}, 1, "90"},
+		{"turned back", [][]vector2.Vector2{placed(notch, 0, vector2.New(5, 5)), placed(notch, 3, vector2.New(20, 3))}, 1, "270"},
+		{"mirrored", [][]vector2.Vector2{notch, {vector2.New(0, 0), vector2.New(2, 0), vector2.New(2, -1)}}, 0, ""},
+		{"single", [][]vector2.Vector2{notch}, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ot := scode.NewOperationTree()
+			for _, pts := range tt.parts {
+				ot.AddOperation(partOperation(pts...))
+			}
+			if got := ExtractSubprograms(ot); got != tt.count {
+				t.Fatalf("extracted %d subprograms, want %d", got, tt.count)
+			}
+			if tt.count == 0 {
+				return
+			}
+
+			call := (*ot)[1].Commands[0]
+			first, last := call.Instructions[0].Tokens, call.Instructions[len(call.Instructions)-1].Tokens
+			at := tt.parts[1][0]
+			if first[0].Identifier != scode.ID_LOCAL_ORIGIN || first[1].Value != fmt.Sprintf("%f", at.X) || first[2].Value != fmt.Sprintf("%f", at.Y) {
+				t.Errorf("call starts %v, want the origin moved to %v", first, at)
+			}
+			if last[0].Identifier != scode.ID_LOCAL_ORIGIN || last[1].Value != "0" || last[2].Value != "0" {
+				t.Errorf("call ends %v, want the origin put back", last)
+			}
+			rotation := ""
+			for _, ins := range call.Instructions {
+				if ins.Tokens[0].Identifier == scode.ID_ROTATE {
+					rotation = ins.Tokens[3].Value
+				}
+				if ins.Tokens[0].Identifier == scode.ID_SUBPROGRAM_CALL && len(ins.Tokens) != 2 {
+					t.Errorf("call %v takes more than the program number", ins.Tokens)
+				}
+			}
+			if rotation != tt.rotation {
+				t.Errorf("rotated %q, want %q", rotation, tt.rotation)
+			}
+
+			sub := (*ot)[len(*ot)-1]
+			if sub.Type != scode.OT_SUBPROGRAM {
+				t.Fatalf("last operation is %v, want the subprogram", sub.Type)
+			}
+			// the subprogram is written about its first position
+			move := sub.Commands[0].Instructions[1].Tokens
+			if move[1].Value != fmt.Sprintf("%f", 0.0) || move[2].Value != fmt.Sprintf("%f", 0.0) {
+				t.Errorf("subprogram starts at %v, want the origin", move)
+			}
+		})
+	}
+}
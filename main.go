@@ -1,10 +1,15 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"os"
+	"os/signal"
 
 	"github.com/029614/gcode_lang/internal/data"
 	nestparser "github.com/029614/gcode_lang/internal/parser/nest"
+	"github.com/029614/gcode_lang/internal/processor"
 	"github.com/029614/gcode_lang/pkg/toolpath"
 )
 
@@ -22,12 +27,45 @@ func main() {
 	}
 	println("nest loaded")
 
-	tp, err := toolpath.Toolpath(parts.Nest, data)
+	router, err := data.RouterLibrary.GetRouterByName("Multicam")
 	if err != nil {
 		panic(err)
 	}
 
-	println(tp)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	tp, err := toolpath.ToolpathContext(ctx, parts.Nest, data, router, &toolpath.ToolpathOptions{
+		Progress: func(sheet, done, total int) {
+			fmt.Printf("sheet %d toolpathed, %d of %d\n", sheet, done, total)
+		},
+	})
+	if err != nil {
+		// the sheets that failed are left out, the rest can still be cut
+		fmt.Println(err)
+	}
+
+	for _, sheet := range *tp {
+		fmt.Printf("sheet %d: %d tool changes, %.1f of rapid travel, %.1f saved over the nested order\n",
+			sheet.Number, sheet.Report.ToolChanges, sheet.Report.RapidDistance,
+			sheet.Report.NestedRapidDistance-sheet.Report.RapidDistance)
+		for _, warning := range sheet.Report.Warnings {
+			fmt.Printf("sheet %d: %v\n", sheet.Number, warning)
+		}
+	}
+
+	for _, sheet := range *tp {
+		ot := sheet.OperationTree()
+		processor.NewMulticamProcessor(router, data.ToolLibrary).PostProcess(ot)
+		err = os.WriteFile(fmt.Sprintf("/Users/samuelmcclure/dev/GitHub/gcode_lang/tests/sawboxtestingCasework/output/PartOutput_casework_sheet_%d.nc", sheet.Number), []byte(ot.GetScript()), 0644)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	err = tp.SaveTabs("/Users/samuelmcclure/dev/GitHub/gcode_lang/tests/sawboxtestingCasework/output/PartOutput_casework_tabs.json")
+	if err != nil {
+		fmt.Println(err)
+	}
 }
 
 func ValidateParts(partlist *nestparser.PartList) error {
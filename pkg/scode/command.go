@@ -18,6 +18,9 @@ const (
 
 	CT_DRILLSET
 	CT_DRILLMOTION
+
+	CT_SUBPROGRAM
+	CT_SUBPROGRAM_CALL
 )
 
 func (com *Command) NewInstruction(tok ...*Token) *Instruction {
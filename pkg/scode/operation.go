@@ -14,6 +14,8 @@ const (
 	OT_END
 	OT_DRILL
 	OT_SPINDLE
+	OT_PART
+	OT_SUBPROGRAM
 )
 
 func (op *Operation) NewCommand(ct CommandType, ins ...*Instruction) *Command {
@@ -35,7 +37,9 @@ func (op *Operation) GetFirstCodeToken() *Token {
 			tok.Identifier == ID_CUT ||
 			tok.Identifier == ID_ARC_CCW_2D ||
 			tok.Identifier == ID_ARC_CW_2D ||
-			tok.Identifier == ID_SPINDLE)
+			tok.Identifier == ID_SPINDLE ||
+			tok.Identifier == ID_SUBPROGRAM ||
+			tok.Identifier == ID_SUBPROGRAM_CALL)
 
 		if valid {
 			return tok
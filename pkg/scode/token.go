@@ -22,6 +22,18 @@ const ID_PARAMETER_K = TokenID("K")       // G-code line that sets the K (Arc Z)
 const ID_PARAMETER_TOOL = TokenID("T")    // G-code line that sets the tool parameter
 const ID_PARAMETER_SPEED = TokenID("S")   // G-code line that sets the RPM parameter
 const ID_PARAMETER_FEED = TokenID("F")    // G-code line that sets the feed rate parameter
+const ID_PARAMETER_PECK = TokenID("Q")    // G-code line that sets the peck depth parameter
+const ID_PARAMETER_RETRACT = TokenID("D") // G-code line that sets the peck retract parameter
+const ID_PARAMETER_GANG = TokenID("GANG") // G-code line that sets the gang drill bits that drop, as a bitmask of the slots
+
+const ID_SUBPROGRAM = TokenID("SUB")        // G-code line that starts a subprogram definition
+const ID_SUBPROGRAM_END = TokenID("SUBEND") // G-code line that ends a subprogram definition
+const ID_SUBPROGRAM_CALL = TokenID("CALL")  // G-code line that calls a subprogram
+const ID_PARAMETER_P = TokenID("P")         // G-code line that sets the subprogram number parameter
+const ID_PARAMETER_R = TokenID("R")         // G-code line that sets the rotation parameter (degrees)
+const ID_LOCAL_ORIGIN = TokenID("ORIGIN")   // G-code line that moves the origin of the coordinates to X Y
+const ID_ROTATE = TokenID("ROTATE")         // G-code line that rotates the coordinates R degrees about X Y
+const ID_ROTATE_END = TokenID("ROTATEEND")  // G-code line that cancels the rotation of the coordinates
 
 type TokenID string
 
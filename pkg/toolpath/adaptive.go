@@ -0,0 +1,173 @@
+package toolpath
+
+import (
+	"math"
+
+	nestparser "github.com/029614/gcode_lang/internal/parser/nest"
+	"github.com/029614/gcode_lang/internal/path"
+	"github.com/Anaxarchus/zero-gdscript/pkg/vector2"
+)
+
+// DefaultMaxEngagement is the tool engagement angle, in degrees, adaptive clearing holds to when the
+// operation sets none.
+const DefaultMaxEngagement = 45.0
+
+// TrochoidRadiusRatio is the radius of the trochoidal loops of adaptive pocketing, relative to the
+// tool radius. It must not exceed 1, or material is left between the bands of loops.
+const TrochoidRadiusRatio = 0.5
+
+// getAdvance returns how far the centre of a trochoid may move each loop so the tool never wraps
+// further into the material than the operation's maximum engagement angle.
+func getAdvance(toolop *ToolpathOperation) float64 {
+	angle := toolop.Operation.MaxEngagement
+	if angle <= 0 || angle > 180 {
+		angle = DefaultMaxEngagement
+	}
+	radius := toolop.Tool.CutDiameter * 0.5
+	advance := radius * (1 - math.Cos(angle*math.Pi/180.0))
+	// keep shallow angles from generating an endless number of loops
+	return math.Max(advance, radius*0.01)
+}
+
+// adaptiveBands returns the centrelines of the bands of trochoidal loops clearing the region,
+// innermost first. Neighbouring bands are a loop diameter apart, so their loops overlap by the
+// tool diameter.
+func adaptiveBands(region pocketRegion, radius, loopRadius float64) [][]vector2.Vector2 {
+	var levels [][][]vector2.Vector2
+	for delta := radius + loopRadius; ; delta += loopRadius * 2 {
+		level := path.OffsetRegion(region.boundary, region.islands, -delta, true)
+		if len(level) == 0 {
+			break
+		}
+		levels = append(levels, level)
+	}
+
+	var bands [][]vector2.Vector2
+	for i := len(levels) - 1; i >= 0; i-- {
+		bands = append(bands, levels[i]...)
+	}
+	return bands
+}
+
+// trochoid returns the points of the tool circling loopRadius about a centre travelling along w,
+// advancing by advance each loop. Counter-clockwise loops climb into the material and clockwise
+// loops cut conventionally. The last loop is made at the end of the chain.
+func trochoid(w *chainWalker, loopRadius, advance float64, clockwise bool) []vector2.Vector2 {
+	steps := arcSteps(loopRadius, 2*math.Pi)
+	total := int(math.Ceil(w.length()/advance)+1) * steps
+
+	pts := make([]vector2.Vector2, 0, total+1)
+	for i := 0; i <= total; i++ {
+		t := 2 * math.Pi * float64(i) / float64(steps)
+		if clockwise {
+			t = -t
+		}
+		c := w.positionAt(math.Min(advance*float64(i)/float64(steps), w.length()))
+		pts = append(pts, c.Add(vector2.New(math.Cos(t), math.Sin(t)).Mulf(loopRadius)))
+	}
+	return pts
+}
+
+// toolpathAdaptivePocket clears each region of a pocket with bands of trochoidal loops, working
+// outward from the middle, then finishes the walls with a contour at the tool radius.
+func toolpathAdaptivePocket(toolop *ToolpathOperation, region pocketRegion) {
+	radius := toolop.Tool.CutDiameter * 0.5
+	loopRadius := radius * TrochoidRadiusRatio
+	advance := getAdvance(toolop)
+
+	// regions too narrow for a band of loops are cut by the wall contour alone
+	bands := adaptiveBands(region, radius, loopRadius)
+	walls := pocketWalls(toolop, region)
+
+	z := toolop.Operation.CutHeight
+	for _, pass := range getPasses(toolop) {
+		for _, band := range bands {
+			w := newChainWalker(band, true)
+			if w == nil {
+				continue
+			}
+			toolop.cutTrochoid(w, loopRadius, advance, z, pass)
+		}
+		for _, loop := range walls {
+			toolop.cutPocketLoop(loop, z, pass)
+		}
+		z = pass.Depth
+	}
+}
+
+// toolpathAdaptiveSlot cuts a chain as a slot of the operation's SlotWidth with trochoidal loops.
+// The compensation side of the operation puts the slot's edge, rather than the tool's, on the chain.
+// It returns false when the slot is too narrow for loops and must be cut as a plain chain.
+func toolpathAdaptiveSlot(toolop *ToolpathOperation, ins *nestparser.Operation, p *path.Path) bool {
+	radius := toolop.Tool.CutDiameter * 0.5
+	loopRadius := (toolop.Operation.SlotWidth - toolop.Tool.CutDiameter) * 0.5
+	if loopRadius < radius*0.05 {
+		return false
+	}
+
+	var w *chainWalker
+	if p.Closed {
+		offset := 0.0
+		if comp := getClosedCompensation(toolop, isInsideChain(ins)); comp != 0 {
+			offset = math.Copysign(toolop.Operation.SlotWidth*0.5, comp)
+		}
+		w = newChainWalker(p.Offset(offset, true).Points, true)
+	} else {
+		op, comp := orientOpen(toolop, p)
+		offset := 0.0
+		if comp != 0 {
+			offset = math.Copysign(toolop.Operation.SlotWidth*0.5, comp)
+		}
+		w = newChainWalker(op.OffsetCapped(offset, false, getEndCap(toolop)).Points, false)
+	}
+	if w == nil {
+		return true
+	}
+
+	advance := getAdvance(toolop)
+	z := getPassStart(toolop)
+	for _, pass := range getPasses(toolop) {
+		toolop.cutTrochoid(w, loopRadius, advance, z, pass)
+		z = pass.Depth
+	}
+	return true
+}
+
+// cutTrochoid spirals down from z to the pass depth about the start of w, then loops along it.
+func (toolop *ToolpathOperation) cutTrochoid(w *chainWalker, loopRadius, advance, z float64, pass Pass) {
+	pts := trochoid(w, loopRadius, advance, isConventional(toolop))
+	toolop.addEntry(pts[0])
+	if z < toolop.Operation.CutHeight {
+		toolop.addPlunge(pts[0], z)
+	}
+	toolop.addHelix(w.points[0], loopRadius, 0, getPocketRamp(toolop, z, pass.Depth), z, pass, isConventional(toolop))
+	toolop.addCut(pass, pts[1:]...)
+	toolop.addRetract()
+}
+
+// addHelix descends around center from z to the pass depth over rampDist of travel, starting and
+// ending at angle, then makes one more full turn at depth.
+func (toolop *ToolpathOperation) addHelix(center vector2.Vector2, radius, angle, rampDist, z float64, pass Pass, clockwise bool) {
+	if radius <= 0 {
+		toolop.addPlunge(center, pass.Depth)
+		return
+	}
+	turns := math.Ceil(rampDist/(2*math.Pi*radius)) + 1
+	steps := arcSteps(radius, 2*math.Pi*turns)
+	dt := 2 * math.Pi * turns / float64(steps)
+	if clockwise {
+		dt = -dt
+	}
+
+	var travel float64
+	for i := 1; i <= steps; i++ {
+		t := angle + dt*float64(i)
+		travel += radius * math.Abs(dt)
+		pz := pass.Depth
+		if rampDist > 0 {
+			pz = z - (z-pass.Depth)*math.Min(travel/rampDist, 1.0)
+		}
+		pt := center.Add(vector2.New(math.Cos(t), math.Sin(t)).Mulf(radius))
+		toolop.Toolpath = append(toolop.Toolpath, ToolpathPoint{pt.X, pt.Y, pz, pass.Feed})
+	}
+}
@@ -0,0 +1,171 @@
+package toolpath
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/029614/gcode_lang/internal/data"
+	nestparser "github.com/029614/gcode_lang/internal/parser/nest"
+	"github.com/029614/gcode_lang/pkg/scode"
+	"github.com/Anaxarchus/zero-gdscript/pkg/vector2"
+)
+
+// DefaultHelixPitch is the depth descended each turn of a helical bore when the operation sets none.
+const DefaultHelixPitch = 0.0625
+
+// boreArc is one block of a helical bore: an arc about the hole's centre turning Sweep radians,
+// no more than half a turn, and ending at End and Z.
+type boreArc struct {
+	End   vector2.Vector2
+	Z     float64
+	Sweep float64
+}
+
+func getHelixPitch(op *data.Operation) float64 {
+	if op.HelixPitch > 0 {
+		return op.HelixPitch
+	}
+	return DefaultHelixPitch
+}
+
+// canBore reports whether the tool can bore a hole of the radius by following its wall. Drills only
+// plunge, and tools as wide as the hole are drills for it.
+func canBore(tool *data.Tool, radius float64) bool {
+	return tool != nil && !isDrill(tool) && tool.Shape == "straight" && tool.CutDiameter < radius*2-DrillTolerance
+}
+
+// matchBore returns the spindle slot and the tool that bores a hole of the radius: the operation's
+// own tool when it can, otherwise the widest loaded router bit that reaches the drill depth. It
+// returns a nil tool if none can.
+func matchBore(toolop *ToolpathOperation, radius float64, loaded map[int]*data.Tool) (int, *data.Tool) {
+	if canBore(toolop.Tool, radius) {
+		return toolop.Slot, toolop.Tool
+	}
+	depth := toolop.Operation.DrillHeight - getDrillDepth(toolop.Operation)
+
+	slot := 0
+	for idx := 1; idx <= data.SpindleSlotCount; idx++ {
+		tool, ok := loaded[idx]
+		if !ok || !canBore(tool, radius) || tool.CutLength < depth {
+			continue
+		}
+		if slot == 0 || tool.CutDiameter > loaded[slot].CutDiameter {
+			slot = idx
+		}
+	}
+	if slot == 0 {
+		return 0, nil
+	}
+	return slot, loaded[slot]
+}
+
+// boreArcs returns the blocks of a helix of the radius about center, starting on the +X side at top
+// and descending pitch each turn down to depth, followed by a finish circle at depth. Each block
+// turns half a circle at most, since controllers can't all cut a full circle in one.
+func boreArcs(center vector2.Vector2, radius, top, depth, pitch float64, clockwise bool) []boreArc {
+	sweep := 2 * math.Pi * (top - depth) / pitch
+	count := max(int(math.Ceil(sweep/math.Pi-1e-9)), 1)
+	dir := 1.0
+	if clockwise {
+		dir = -1.0
+	}
+
+	arcs := make([]boreArc, 0, count+2)
+	for i := 1; i <= count; i++ {
+		t := float64(i) / float64(count)
+		end := center.Add(rotate(vector2.New(radius, 0), dir*sweep*t))
+		arcs = append(arcs, boreArc{End: end, Z: top - (top-depth)*t, Sweep: dir * sweep / float64(count)})
+	}
+	last := arcs[len(arcs)-1].End
+	arcs = append(arcs,
+		boreArc{End: center.Sub(last.Sub(center)), Z: depth, Sweep: dir * math.Pi},
+		boreArc{End: last, Z: depth, Sweep: dir * math.Pi},
+	)
+	return arcs
+}
+
+// getBoreArcs returns the compensated helix boring the hole, climbing unless the operation cuts
+// conventionally.
+func (toolop *ToolpathOperation) getBoreArcs(arc nestparser.ArcGeometry) []boreArc {
+	op := toolop.Operation
+	radius := arc.Radius - toolop.Tool.CutDiameter*0.5
+	return boreArcs(arc.Position.Vector2, radius, op.DrillHeight, getDrillDepth(op), getHelixPitch(op), isConventional(toolop))
+}
+
+// boreHole bores a hole wider than the tool by spiralling down its wall, then cuts a finish circle
+// at depth and returns to the centre before retracting.
+func (toolop *ToolpathOperation) boreHole(arc nestparser.ArcGeometry) {
+	op := toolop.Operation
+	feed := float64(op.FeedRate)
+	center := arc.Position.Vector2
+	radius := arc.Radius - toolop.Tool.CutDiameter*0.5
+
+	start := center.Add(vector2.New(radius, 0))
+	toolop.Toolpath = append(toolop.Toolpath,
+		ToolpathPoint{center.X, center.Y, op.FeedHeight, 0},
+		ToolpathPoint{center.X, center.Y, op.DrillHeight, 0},
+		ToolpathPoint{start.X, start.Y, op.DrillHeight, feed},
+	)
+
+	from, z := start, op.DrillHeight
+	for _, a := range toolop.getBoreArcs(arc) {
+		steps := arcSteps(center.DistanceTo(from), a.Sweep)
+		for i := 1; i <= steps; i++ {
+			t := float64(i) / float64(steps)
+			pt := center.Add(rotate(from.Sub(center), a.Sweep*t))
+			toolop.Toolpath = append(toolop.Toolpath, ToolpathPoint{pt.X, pt.Y, z + (a.Z-z)*t, feed})
+		}
+		from, z = a.End, a.Z
+	}
+
+	toolop.Toolpath = append(toolop.Toolpath,
+		ToolpathPoint{center.X, center.Y, z, feed},
+		ToolpathPoint{center.X, center.Y, op.FeedHeight, 0},
+	)
+}
+
+// BoreOperation returns the scode spindle operation of the holes the operation's tool bores, with
+// the helix and finish circle as arc blocks of at most half a turn.
+func (toolop *ToolpathOperation) BoreOperation() *scode.Operation {
+	op := toolop.Operation
+	set := scode.NewCommand(scode.CT_SPINDLESET,
+		scode.NewInstruction(
+			scode.NewToken(scode.ID_SPINDLE, ""),
+			scode.NewToken(scode.ID_PARAMETER_TOOL, fmt.Sprintf("%d", toolop.Slot)),
+			scode.NewToken(scode.ID_PARAMETER_SPEED, fmt.Sprintf("%d", op.SpindleRPM)),
+		),
+	)
+
+	arcID := scode.ID_ARC_CCW_2D
+	if isConventional(toolop) {
+		arcID = scode.ID_ARC_CW_2D
+	}
+	feed := float64(op.FeedRate)
+	last := 0.0
+
+	motion := scode.NewCommand(scode.CT_SPINDLEMOTION)
+	for _, ins := range toolop.Instance {
+		arc, ok := ins.Geometry.(nestparser.ArcGeometry)
+		if !ok || matchesHole(toolop.Tool, arc.Radius) || !canBore(toolop.Tool, arc.Radius) {
+			continue
+		}
+		center := arc.Position.Vector2
+		from := center.Add(vector2.New(arc.Radius-toolop.Tool.CutDiameter*0.5, 0))
+
+		motion.NewInstruction(toolop.moveTokens(scode.ID_MOVE, center, op.FeedHeight)...)
+		motion.NewInstruction(toolop.moveTokens(scode.ID_MOVE, center, op.DrillHeight)...)
+		motion.NewInstruction(append(toolop.moveTokens(scode.ID_CUT, from, op.DrillHeight), feedTokens(feed, &last)...)...)
+		z := op.DrillHeight
+		for _, a := range toolop.getBoreArcs(arc) {
+			offset := center.Sub(from)
+			motion.NewInstruction(append(toolop.moveTokens(arcID, a.End, a.Z),
+				scode.NewToken(scode.ID_PARAMETER_I, fmt.Sprintf("%f", offset.X)),
+				scode.NewToken(scode.ID_PARAMETER_J, fmt.Sprintf("%f", offset.Y)),
+			)...)
+			from, z = a.End, a.Z
+		}
+		motion.NewInstruction(toolop.moveTokens(scode.ID_CUT, center, z)...)
+		motion.NewInstruction(toolop.moveTokens(scode.ID_MOVE, center, op.FeedHeight)...)
+	}
+	return scode.NewOperation(scode.OT_SPINDLE, set, motion)
+}
@@ -0,0 +1,114 @@
+package toolpath
+
+import (
+	"math"
+
+	nestparser "github.com/029614/gcode_lang/internal/parser/nest"
+	"github.com/029614/gcode_lang/internal/path"
+	"github.com/Anaxarchus/zero-gdscript/pkg/vector2"
+)
+
+// Cut directions of data.Operation.Direction, for a spindle turning clockwise.
+const (
+	DirectionClimb        = "climb"
+	DirectionConventional = "conventional"
+)
+
+// isConventional reports whether the operation cuts conventionally. Operations without a direction climb.
+func isConventional(toolop *ToolpathOperation) bool {
+	return toolop.Operation.Direction == DirectionConventional
+}
+
+// isInsideChain reports whether a closed chain is a cutout of its part, rather than its perimeter
+// or an island within a cutout, by counting the part's through cuts around the whole of it. Other
+// chains, such as dados running to the part's edge, don't cut the part and enclose nothing.
+func isInsideChain(ins *nestparser.Operation) bool {
+	chain, ok := ins.Geometry.(nestparser.ChainGeometry)
+	if !ok || ins.Part == nil || len(chain.Points) == 0 {
+		return false
+	}
+	p := getPath(ins)
+	if p == nil {
+		return false
+	}
+
+	inside := false
+	for _, other := range ins.Part.Geometry.Chains {
+		cg, ok := other.Geometry.(nestparser.ChainGeometry)
+		if !ok || other.Operation != PartCutOperation || cg.Closed != 1 || len(cg.Points) == 0 || &cg.Points[0] == &chain.Points[0] {
+			continue
+		}
+		if loop := getPath(&other); loop != nil && encloses(loop.Points, p.Points) {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// encloses reports whether the loop is larger than the chain and holds every point of it, taking
+// points on the loop as within it.
+func encloses(loop, chain []vector2.Vector2) bool {
+	if math.Abs(path.Area(loop)) <= math.Abs(path.Area(chain)) {
+		return false
+	}
+	for _, pt := range chain {
+		if !path.PointInPolygon(pt, loop) && distanceToChain(pt, loop) > ChainTolerance {
+			return false
+		}
+	}
+	return true
+}
+
+// getClosedCompensation returns the offset of a closed chain. Compensating "right" keeps the tool off
+// the part, outward on perimeters and inward on cutouts, and "left" puts it on the part's side.
+func getClosedCompensation(toolop *ToolpathOperation, inside bool) float64 {
+	offset := getCompensation(toolop)
+	if inside {
+		return -offset
+	}
+	return offset
+}
+
+// orientClosed winds a closed path for the operation's cut direction. Climbing keeps the part on
+// the right of the tool, so perimeters run clockwise and cutouts counter-clockwise.
+func orientClosed(toolop *ToolpathOperation, p *path.Path, inside bool) *path.Path {
+	clockwise := !inside
+	if isConventional(toolop) {
+		clockwise = !clockwise
+	}
+	if (path.Area(p.Points) < 0) != clockwise {
+		return p.Reversed()
+	}
+	return p
+}
+
+// orientOpen returns an open path running in the operation's cut direction, with its compensation.
+// Climbing needs the tool on the left of the chain, so a chain compensated to the right is reversed
+// and compensated to the left, which leaves the tool on the same side of the line.
+func orientOpen(toolop *ToolpathOperation, p *path.Path) (*path.Path, float64) {
+	offset := getCompensation(toolop)
+	if offset == 0 {
+		return p, offset
+	}
+	if (offset > 0) != isConventional(toolop) {
+		return p.Reversed(), -offset
+	}
+	return p, offset
+}
+
+// orientLoop winds a pocket loop for the operation's cut direction. Offsetting returns outlines
+// counter-clockwise and islands clockwise, which is the climbing direction for both.
+func orientLoop(toolop *ToolpathOperation, loop []vector2.Vector2) []vector2.Vector2 {
+	if isConventional(toolop) {
+		return reversed(loop)
+	}
+	return loop
+}
+
+func reversed(points []vector2.Vector2) []vector2.Vector2 {
+	res := make([]vector2.Vector2, len(points))
+	for i, pt := range points {
+		res[len(points)-1-i] = pt
+	}
+	return res
+}
@@ -0,0 +1,90 @@
+package toolpath
+
+import (
+	"math"
+	"testing"
+
+	nestparser "github.com/029614/gcode_lang/internal/parser/nest"
+	"github.com/Anaxarchus/zero-gdscript/pkg/vector2"
+)
+
+func TestIsInsideChain(t *testing.T) {
+	size := vector2.New(20, 10)
+	tests := []struct {
+		name   string
+		chains []nestparser.Operation // the part's chains after its perimeter
+		index  int                    // of the chain classified, 0 for the perimeter
+		inside bool
+	}{
+		{"perimeter", nil, 0, false},
+		{"perimeter under a dado touching it", []nestparser.Operation{
+			rectChain("DadoBack", vector2.Zero(), vector2.New(20, 0.5)),
+		}, 0, false},
+		{"perimeter under a dado running off the part", []nestparser.Operation{
+			rectChain("DadoBack", vector2.New(-0.5, -0.5), vector2.New(21, 1)),
+		}, 0, false},
+		{"cutout", []nestparser.Operation{
+			rectChain(PartCutOperation, vector2.New(8, 3), vector2.New(4, 4)),
+		}, 1, true},
+		{"cutout touching a dado", []nestparser.Operation{
+			rectChain("DadoBack", vector2.New(2, 3), vector2.New(6, 4)),
+			rectChain(PartCutOperation, vector2.New(8, 3), vector2.New(4, 4)),
+		}, 2, true},
+		{"island in a cutout", []nestparser.Operation{
+			rectChain(PartCutOperation, vector2.New(8, 3), vector2.New(4, 4)),
+			rectChain(PartCutOperation, vector2.New(9, 4), vector2.New(2, 2)),
+		}, 2, false},
+		{"pocket touching the perimeter", []nestparser.Operation{
+			rectChain("Pocket", vector2.Zero(), vector2.New(4, 4)),
+		}, 1, true},
+		{"dado running off the part", []nestparser.Operation{
+			rectChain("DadoBack", vector2.New(-0.5, 4), vector2.New(21, 1)),
+		}, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			part := testPart("part", vector2.New(1, 1), size, tt.chains...)
+			if got := isInsideChain(&part.Geometry.Chains[tt.index]); got != tt.inside {
+				t.Errorf("isInsideChain = %v, want %v", got, tt.inside)
+			}
+		})
+	}
+}
+
+// TestToolpathChainPerimeterSize checks the perimeter is cut a tool radius outside the part whatever
+// other chains cross it.
+func TestToolpathChainPerimeterSize(t *testing.T) {
+	origin, size := vector2.New(1, 1), vector2.New(20, 10)
+	tests := []struct {
+		name   string
+		chains []nestparser.Operation
+	}{
+		{"plain", nil},
+		{"dado touching the perimeter", []nestparser.Operation{rectChain("DadoBack", vector2.Zero(), vector2.New(20, 0.5))}},
+		{"dado running off the part", []nestparser.Operation{rectChain("DadoBack", vector2.New(-0.5, -0.5), vector2.New(21, 1))}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			part := testPart("part", origin, size, tt.chains...)
+			toolop := testOperation(testCut(), testTool(), part)
+			if err := toolpathChain(toolop); err != nil {
+				t.Fatal(err)
+			}
+			checkToolpath(t, toolop)
+
+			radius := toolop.Tool.CutDiameter * 0.5
+			lo, hi := vector2.New(math.Inf(1), math.Inf(1)), vector2.New(math.Inf(-1), math.Inf(-1))
+			for _, pt := range toolop.Toolpath {
+				if pt[3] != 0 && pt[2] < toolop.Operation.CutHeight {
+					lo = vector2.New(math.Min(lo.X, pt[0]), math.Min(lo.Y, pt[1]))
+					hi = vector2.New(math.Max(hi.X, pt[0]), math.Max(hi.Y, pt[1]))
+				}
+			}
+			want := origin.Sub(vector2.New(radius, radius))
+			wantHi := origin.Add(size).Add(vector2.New(radius, radius))
+			if !near(lo, want) || !near(hi, wantHi) {
+				t.Errorf("cut spans %v..%v, want %v..%v", lo, hi, want, wantHi)
+			}
+		})
+	}
+}
@@ -0,0 +1,314 @@
+package toolpath
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/029614/gcode_lang/internal/data"
+	nestparser "github.com/029614/gcode_lang/internal/parser/nest"
+	"github.com/029614/gcode_lang/internal/patterns"
+	"github.com/029614/gcode_lang/pkg/scode"
+	"github.com/Anaxarchus/zero-gdscript/pkg/vector2"
+)
+
+// DrillTolerance is the largest difference between a hole's diameter and a drill's cut diameter for
+// the drill to make the hole.
+const DrillTolerance = 0.005
+
+// getDrillDepth returns the Z an operation drills down to.
+func getDrillDepth(op *data.Operation) float64 {
+	if op.DrillDepth < 0 {
+		return op.DrillHeight + op.DrillDepth
+	}
+	return op.DrillDepth
+}
+
+// matchesHole reports whether the tool drills a hole of the radius.
+func matchesHole(tool *data.Tool, radius float64) bool {
+	return tool != nil && math.Abs(tool.CutDiameter-radius*2) <= DrillTolerance
+}
+
+// matchDrill returns the spindle slot and the tool that drills a hole of the radius. The operation's
+// own tool is used when it fits, then the closest loaded drill, then the closest drill in the library.
+// It returns a nil tool if none fits.
+func matchDrill(toolop *ToolpathOperation, radius float64, loaded map[int]*data.Tool, tools *data.ToolLibrary) (int, *data.Tool) {
+	if matchesHole(toolop.Tool, radius) {
+		return toolop.Slot, toolop.Tool
+	}
+
+	slot := 0
+	best := math.Inf(1)
+	for idx := 1; idx <= data.SpindleSlotCount; idx++ {
+		tool, ok := loaded[idx]
+		if !ok || !isDrill(tool) || !matchesHole(tool, radius) {
+			continue
+		}
+		if d := math.Abs(tool.CutDiameter - radius*2); d < best {
+			best = d
+			slot = idx
+		}
+	}
+	if slot != 0 {
+		return slot, loaded[slot]
+	}
+
+	var res *data.Tool
+	if tools != nil {
+		for _, tool := range *tools {
+			if !isDrill(tool) || !matchesHole(tool, radius) {
+				continue
+			}
+			if d := math.Abs(tool.CutDiameter - radius*2); d < best {
+				best = d
+				res = tool
+			}
+		}
+	}
+	return 0, res
+}
+
+// selectDrillTools splits a drill operation into the holes the gang drill's bits fit, then by the
+// tool that drills each remaining hole, or bores it when the hole is wider than any drill. Holes no
+// tool matches are kept in an operation without a tool, which reports them when toolpathed.
+func selectDrillTools(toolop *ToolpathOperation, router *data.Router, tools *data.ToolLibrary) []*ToolpathOperation {
+	if toolop.Operation.Type != "DRILL" {
+		return []*ToolpathOperation{toolop}
+	}
+	loaded := getSpindleTools(router, tools)
+
+	var res []*ToolpathOperation
+	gang, rest := selectGangHits(toolop, router, tools)
+	if gang != nil {
+		res = append(res, gang)
+	}
+	byTool := make(map[*data.Tool]*ToolpathOperation)
+	for _, ins := range rest {
+		slot, tool := toolop.Slot, toolop.Tool
+		if arc, ok := ins.Geometry.(nestparser.ArcGeometry); ok {
+			slot, tool = matchDrill(toolop, arc.Radius, loaded, tools)
+			if tool == nil {
+				slot, tool = matchBore(toolop, arc.Radius, loaded)
+			}
+		}
+
+		top, ok := byTool[tool]
+		if !ok {
+			top = &ToolpathOperation{
+				Operation: toolop.Operation,
+				Tool:      tool,
+				Slot:      slot,
+				Material:  toolop.Material,
+				Z:         toolop.Z,
+				Parts:     toolop.Parts,
+				Instance:  []*nestparser.Operation{},
+			}
+			byTool[tool] = top
+			res = append(res, top)
+		}
+		top.Instance = append(top.Instance, ins)
+	}
+	return res
+}
+
+// selectGangHits plans the hits of the router's gang drill that drill the operation's holes its bits
+// fit. It returns the operation drilling them with the gang, or nil when the gang drills none, and
+// the instances left for the spindle.
+func selectGangHits(toolop *ToolpathOperation, router *data.Router, tools *data.ToolLibrary) (*ToolpathOperation, []*nestparser.Operation) {
+	slots := patterns.GetGangSlots(router, tools)
+	if len(slots) == 0 {
+		return nil, toolop.Instance
+	}
+
+	var holes []patterns.GangHole
+	var drills []*nestparser.Operation
+	for _, ins := range toolop.Instance {
+		if arc, ok := ins.Geometry.(nestparser.ArcGeometry); ok {
+			holes = append(holes, patterns.GangHole{
+				Position: [2]float64{arc.Position.X, arc.Position.Y},
+				Diameter: arc.Radius * 2,
+			})
+			drills = append(drills, ins)
+		}
+	}
+	hits, _ := patterns.PlanGangHits(holes, slots)
+	if len(hits) == 0 {
+		return nil, toolop.Instance
+	}
+
+	gang := &ToolpathOperation{
+		Operation: toolop.Operation,
+		Material:  toolop.Material,
+		Z:         toolop.Z,
+		Parts:     toolop.Parts,
+		Instance:  []*nestparser.Operation{},
+		Gang:      hits,
+	}
+	drilled := make(map[*nestparser.Operation]bool)
+	for _, hit := range hits {
+		for _, i := range hit.Holes {
+			drilled[drills[i]] = true
+		}
+	}
+	var rest []*nestparser.Operation
+	for _, ins := range toolop.Instance {
+		if drilled[ins] {
+			gang.Instance = append(gang.Instance, ins)
+		} else {
+			rest = append(rest, ins)
+		}
+	}
+	return gang, rest
+}
+
+// getDrillFeed returns the rate holes are drilled at: the plunge rate, or the feed rate if none is set.
+func getDrillFeed(op *data.Operation) float64 {
+	if op.PlungeRate > 0 {
+		return float64(op.PlungeRate)
+	}
+	return float64(op.FeedRate)
+}
+
+// getPecks returns the depths a hole is drilled to in turn, ending at the drill depth.
+func getPecks(op *data.Operation) []float64 {
+	depth := getDrillDepth(op)
+	total := op.DrillHeight - depth
+	if op.PeckDepth <= 0 || total <= op.PeckDepth {
+		return []float64{depth}
+	}
+	count := int(math.Ceil(total/op.PeckDepth - 1e-9))
+	pecks := make([]float64, 0, count)
+	for i := 1; i <= count; i++ {
+		pecks = append(pecks, op.DrillHeight-total*float64(i)/float64(count))
+	}
+	return pecks
+}
+
+// toolpathArc drills the holes of a drill operation, pecking down to the drill depth, and bores
+// the holes wider than its tool.
+func toolpathArc(toolop *ToolpathOperation) error {
+	if len(toolop.Gang) > 0 {
+		return toolpathGang(toolop)
+	}
+	op := toolop.Operation
+
+	var errs []error
+	for _, ins := range toolop.Instance {
+		arc, ok := ins.Geometry.(nestparser.ArcGeometry)
+		if !ok {
+			continue
+		}
+		if !matchesHole(toolop.Tool, arc.Radius) && canBore(toolop.Tool, arc.Radius) {
+			toolop.boreHole(arc)
+			continue
+		}
+		if !matchesHole(toolop.Tool, arc.Radius) {
+			errs = append(errs, fmt.Errorf("operation %s: no tool drills the %.4f hole at (%.4f, %.4f)",
+				op.Name, arc.Radius*2, arc.Position.X, arc.Position.Y))
+			continue
+		}
+
+		toolop.addDrill(arc.Position.Vector2)
+	}
+	return errors.Join(errs...)
+}
+
+// toolpathGang drills the hits of a gang drill operation, the head over slot 1's position.
+func toolpathGang(toolop *ToolpathOperation) error {
+	for _, hit := range toolop.Gang {
+		toolop.addDrill(vector2.New(hit.Position[0], hit.Position[1]))
+	}
+	return nil
+}
+
+// addDrill drills a hole at the position, pecking down to the drill depth.
+func (toolop *ToolpathOperation) addDrill(pos vector2.Vector2) {
+	op := toolop.Operation
+	feed := getDrillFeed(op)
+	toolop.Toolpath = append(toolop.Toolpath,
+		ToolpathPoint{pos.X, pos.Y, op.FeedHeight, 0},
+		ToolpathPoint{pos.X, pos.Y, op.DrillHeight, 0},
+	)
+	z := op.DrillHeight
+	for _, peck := range getPecks(op) {
+		if z < op.DrillHeight {
+			// rapid back down to the bottom of the last peck
+			toolop.Toolpath = append(toolop.Toolpath, ToolpathPoint{pos.X, pos.Y, z, 0})
+		}
+		toolop.Toolpath = append(toolop.Toolpath, ToolpathPoint{pos.X, pos.Y, peck, feed})
+		toolop.Toolpath = append(toolop.Toolpath, ToolpathPoint{pos.X, pos.Y, getPeckRetract(op, peck), 0})
+		z = peck
+	}
+	toolop.Toolpath = append(toolop.Toolpath, ToolpathPoint{pos.X, pos.Y, op.FeedHeight, 0})
+}
+
+// getPeckRetract returns the Z the drill backs off to after a peck.
+func getPeckRetract(op *data.Operation, z float64) float64 {
+	if op.PeckRetract <= 0 {
+		return op.DrillHeight
+	}
+	return math.Min(z+op.PeckRetract, op.DrillHeight)
+}
+
+// DrillOperation returns the scode drill operation of the holes the operation's tool drills, or of
+// its gang drill hits with the slots each drops, at the rate its toolpath drills them.
+func (toolop *ToolpathOperation) DrillOperation() *scode.Operation {
+	op := toolop.Operation
+	if len(toolop.Gang) > 0 {
+		return toolop.gangOperation()
+	}
+	set := scode.NewCommand(scode.CT_DRILLSET,
+		scode.NewInstruction(
+			scode.NewToken(scode.ID_DRILL, ""),
+			scode.NewToken(scode.ID_PARAMETER_TOOL, fmt.Sprintf("%d", toolop.Slot)),
+			scode.NewToken(scode.ID_PARAMETER_FEED, fmt.Sprintf("%g", getDrillFeed(op))),
+			scode.NewToken(scode.ID_PARAMETER_SPEED, fmt.Sprintf("%d", op.SpindleRPM)),
+		),
+	)
+
+	motion := scode.NewCommand(scode.CT_DRILLMOTION)
+	for _, ins := range toolop.Instance {
+		arc, ok := ins.Geometry.(nestparser.ArcGeometry)
+		if !ok || !matchesHole(toolop.Tool, arc.Radius) {
+			continue
+		}
+		motion.NewInstruction(toolop.drillTokens(arc.Position.Vector2)...)
+	}
+	return scode.NewOperation(scode.OT_DRILL, set, motion)
+}
+
+func (toolop *ToolpathOperation) gangOperation() *scode.Operation {
+	op := toolop.Operation
+	set := scode.NewCommand(scode.CT_DRILLSET,
+		scode.NewInstruction(
+			scode.NewToken(scode.ID_DRILL, ""),
+			scode.NewToken(scode.ID_PARAMETER_FEED, fmt.Sprintf("%g", getDrillFeed(op))),
+			scode.NewToken(scode.ID_PARAMETER_SPEED, fmt.Sprintf("%d", op.SpindleRPM)),
+		),
+	)
+
+	motion := scode.NewCommand(scode.CT_DRILLMOTION)
+	for _, hit := range toolop.Gang {
+		toks := toolop.drillTokens(vector2.New(hit.Position[0], hit.Position[1]))
+		toks = append(toks, scode.NewToken(scode.ID_PARAMETER_GANG, fmt.Sprintf("%d", hit.Mask)))
+		motion.NewInstruction(toks...)
+	}
+	return scode.NewOperation(scode.OT_DRILL, set, motion)
+}
+
+func (toolop *ToolpathOperation) drillTokens(pos vector2.Vector2) []*scode.Token {
+	op := toolop.Operation
+	toks := []*scode.Token{
+		scode.NewToken(scode.ID_DRILL, ""),
+		scode.NewToken(scode.ID_PARAMETER_X, fmt.Sprintf("%f", pos.X)),
+		scode.NewToken(scode.ID_PARAMETER_Y, fmt.Sprintf("%f", pos.Y)),
+		scode.NewToken(scode.ID_PARAMETER_Z, fmt.Sprintf("%f", toolop.Z.Machine(getDrillDepth(op)))),
+	}
+	if op.PeckDepth > 0 {
+		toks = append(toks, scode.NewToken(scode.ID_PARAMETER_PECK, fmt.Sprintf("%f", op.PeckDepth)))
+		if op.PeckRetract > 0 {
+			toks = append(toks, scode.NewToken(scode.ID_PARAMETER_RETRACT, fmt.Sprintf("%f", op.PeckRetract)))
+		}
+	}
+	return toks
+}
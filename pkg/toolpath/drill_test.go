@@ -0,0 +1,109 @@
+package toolpath
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/029614/gcode_lang/internal/data"
+	nestparser "github.com/029614/gcode_lang/internal/parser/nest"
+	"github.com/Anaxarchus/zero-gdscript/pkg/vector2"
+)
+
+// loadResource reads the named file of tests/resources into v.
+func loadResource(t *testing.T, name string, v any) {
+	t.Helper()
+	b, err := os.ReadFile("../../tests/resources/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestToolpathResourceDrills drills the holes the casework job uses each drill operation of the
+// repository's data for, away from the gang drill.
+func TestToolpathResourceDrills(t *testing.T) {
+	var ops data.OperationLibrary
+	var tools data.ToolLibrary
+	loadResource(t, "operations.json", &ops)
+	loadResource(t, "toollib.json", &tools)
+
+	tests := []struct {
+		operation string
+		radius    float64
+		tool      string
+		depth     float64 // the Z drilled down to
+		pecks     int
+	}{
+		{"DRILL3MM", 0.05906, "3MM V-POINT DRILL", 0.375, 3},
+		{"BLOCKDRILLSYSTEM", 0.09843, "5MM BRADPOINT DRILL", 0.5, 1},
+		{"BLOCKDRILLPILOT", 0.07874, "4MM V-POINT DRILL", 0.125, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.operation, func(t *testing.T) {
+			op, err := ops.GetOperationByName(tt.operation)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tool, err := tools.GetToolByID(op.Tool)
+			if err != nil {
+				t.Fatal(err)
+			}
+			part := testPart("part", vector2.New(1, 1), vector2.New(20, 10))
+			holes := []vector2.Vector2{vector2.New(3, 3), vector2.New(15, 7)}
+			toolop := &ToolpathOperation{Operation: op, Tool: tool, Parts: []*nestparser.Part{part}}
+			for _, pos := range holes {
+				toolop.Instance = append(toolop.Instance, &nestparser.Operation{
+					Operation: op.Name,
+					Geometry:  nestparser.ArcGeometry{Radius: tt.radius, Position: nestparser.Point{Vector2: part.Place(pos)}},
+					Part:      part,
+				})
+			}
+			if err := (ZReference{Thickness: 0.75}).checkOperation(toolop); err != nil {
+				t.Fatal(err)
+			}
+
+			split := selectDrillTools(toolop, nil, &tools)
+			if len(split) != 1 || split[0].Tool == nil || split[0].Tool.Name != tt.tool {
+				t.Fatalf("drilled by %d operations, want one with %s", len(split), tt.tool)
+			}
+			drill := split[0]
+			if err := drill.toolpath(); err != nil {
+				t.Fatal(err)
+			}
+
+			tp := drill.Toolpath
+			if len(tp) == 0 || tp[0][3] != 0 || tp[0][2] != op.FeedHeight || tp[len(tp)-1][2] != op.FeedHeight {
+				t.Fatalf("toolpath %v doesn't start and end at the feed height %v", tp, op.FeedHeight)
+			}
+			deepest := map[vector2.Vector2]float64{}
+			plunges := 0
+			for k, pt := range tp {
+				pos := vector2.New(pt[0], pt[1])
+				if k > 0 && pt[2] != tp[k-1][2] && !near(pos, vector2.New(tp[k-1][0], tp[k-1][1])) {
+					t.Errorf("point %d %v moves across and up or down", k, pt)
+				}
+				if pt[3] != 0 {
+					plunges++
+					if pt[3] != getDrillFeed(op) {
+						t.Errorf("point %d %v drills at %v, want %v", k, pt, pt[3], getDrillFeed(op))
+					}
+				}
+				if d, ok := deepest[pos]; !ok || pt[2] < d {
+					deepest[pos] = pt[2]
+				}
+			}
+			if plunges != tt.pecks*len(holes) {
+				t.Errorf("%d pecks, want %d a hole", plunges, tt.pecks)
+			}
+			for _, pos := range holes {
+				if d, ok := deepest[part.Place(pos)]; !ok || math.Abs(d-tt.depth) > testTolerance {
+					t.Errorf("hole at %v drilled to %v, want %v", part.Place(pos), d, tt.depth)
+				}
+			}
+		})
+	}
+}
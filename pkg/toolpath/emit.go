@@ -0,0 +1,130 @@
+package toolpath
+
+import (
+	"fmt"
+
+	"github.com/029614/gcode_lang/pkg/scode"
+	"github.com/Anaxarchus/zero-gdscript/pkg/vector2"
+)
+
+// OperationTree returns the scode program of the sheet: the job start, the operations in the order
+// they are cut, and the job end.
+func (tsh *ToolpathSheet) OperationTree() *scode.OperationTree {
+	ot := scode.NewOperationTree(scode.NewOperation(scode.OT_START,
+		scode.NewCommand(scode.CT_START, scode.NewInstruction(
+			scode.NewToken(scode.ID_JOB_START, ""),
+			scode.NewToken(scode.ID_COMMENT, fmt.Sprintf("Sheet %d", tsh.Number)),
+		)),
+	))
+	for _, toolop := range tsh.Operations {
+		if toolop.Operation.Type != "DRILL" {
+			ot.AddOperation(toolop.PartOperations()...)
+			continue
+		}
+		// a drill operation bores the holes wider than its tool
+		for _, op := range []*scode.Operation{toolop.DrillOperation(), toolop.BoreOperation()} {
+			if hasMotion(op) {
+				ot.AddOperation(op)
+			}
+		}
+	}
+	ot.AddOperation(scode.NewOperation(scode.OT_END,
+		scode.NewCommand(scode.CT_STOP, scode.NewInstruction(scode.NewToken(scode.ID_JOB_END, ""))),
+	))
+	return ot
+}
+
+// hasMotion reports whether the operation moves the machine at all.
+func hasMotion(op *scode.Operation) bool {
+	for _, com := range op.Commands {
+		if (com.Type == scode.CT_SPINDLEMOTION || com.Type == scode.CT_DRILLMOTION) && len(com.Instructions) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// SpindleOperation returns the scode spindle operation following the operation's toolpath. Feed
+// rates are modal, so F words are only written where the feed changes.
+func (toolop *ToolpathOperation) SpindleOperation() *scode.Operation {
+	last := 0.0
+	return scode.NewOperation(scode.OT_SPINDLE, toolop.spindleSet(), toolop.motion(toolop.Toolpath, &last))
+}
+
+// PartOperations returns the scode operations following the operation's toolpath: a spindle
+// operation setting the spindle up, and then an OT_PART operation for the cut of each part, with the
+// travel between parts in spindle operations. The travel into and the retract out of a part are left
+// to the spindle operations, as planRapids lowers them differently part to part, and each part
+// writes its first feed, so a processor can call the parts that cut alike as one subprogram.
+func (toolop *ToolpathOperation) PartOperations() []*scode.Operation {
+	ops := []*scode.Operation{scode.NewOperation(scode.OT_SPINDLE, toolop.spindleSet())}
+	tp := toolop.Toolpath
+	last := 0.0
+	add := func(otype scode.OperationType, from, to int) {
+		if from < to {
+			ops = append(ops, scode.NewOperation(otype, toolop.motion(tp[from:to], &last)))
+		}
+	}
+
+	k := 0
+	for _, span := range toolop.Spans {
+		from, to := span.From, span.To
+		if from < to && tp[from][3] == 0 {
+			from++
+		}
+		if from < to && tp[to-1][3] == 0 {
+			to--
+		}
+		add(scode.OT_SPINDLE, k, from)
+		last = 0
+		add(scode.OT_PART, from, to)
+		k = to
+	}
+	add(scode.OT_SPINDLE, k, len(tp))
+	return ops
+}
+
+// spindleSet returns the command loading the operation's tool and setting its speed.
+func (toolop *ToolpathOperation) spindleSet() *scode.Command {
+	return scode.NewCommand(scode.CT_SPINDLESET,
+		scode.NewInstruction(
+			scode.NewToken(scode.ID_SPINDLE, ""),
+			scode.NewToken(scode.ID_PARAMETER_TOOL, fmt.Sprintf("%d", toolop.Slot)),
+			scode.NewToken(scode.ID_PARAMETER_SPEED, fmt.Sprintf("%d", toolop.Operation.SpindleRPM)),
+		),
+	)
+}
+
+// motion returns the command following the points of a toolpath, with last the feed in effect.
+func (toolop *ToolpathOperation) motion(tp []ToolpathPoint, last *float64) *scode.Command {
+	com := scode.NewCommand(scode.CT_SPINDLEMOTION)
+	for _, pt := range tp {
+		pos := vector2.New(pt[0], pt[1])
+		if pt[3] == 0 {
+			com.NewInstruction(toolop.moveTokens(scode.ID_MOVE, pos, pt[2])...)
+			continue
+		}
+		com.NewInstruction(append(toolop.moveTokens(scode.ID_CUT, pos, pt[2]), feedTokens(pt[3], last)...)...)
+	}
+	return com
+}
+
+// moveTokens returns the words of a move to the position at the absolute Z, in the machine's Z.
+func (toolop *ToolpathOperation) moveTokens(id scode.TokenID, pos vector2.Vector2, z float64) []*scode.Token {
+	return []*scode.Token{
+		scode.NewToken(id, ""),
+		scode.NewToken(scode.ID_PARAMETER_X, fmt.Sprintf("%f", pos.X)),
+		scode.NewToken(scode.ID_PARAMETER_Y, fmt.Sprintf("%f", pos.Y)),
+		scode.NewToken(scode.ID_PARAMETER_Z, fmt.Sprintf("%f", toolop.Z.Machine(z))),
+	}
+}
+
+// feedTokens returns the F word of a cutting move at the feed, or nothing if last, the feed already
+// in effect, is the same. The feed is in effect from then on.
+func feedTokens(feed float64, last *float64) []*scode.Token {
+	if feed == *last {
+		return nil
+	}
+	*last = feed
+	return []*scode.Token{scode.NewToken(scode.ID_PARAMETER_FEED, fmt.Sprintf("%g", feed))}
+}
@@ -0,0 +1,182 @@
+package toolpath
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// FeedsAuto is the value of data.Operation.Feeds that has the feed rates and spindle speed
+// calculated from the chipload table instead of taken from the operation.
+const FeedsAuto = "auto"
+
+// DefaultSpindleRPM is the spindle speed automatic feeds run at, unless the tool is limited to less.
+const DefaultSpindleRPM = 18000
+
+// PlungeRatio is the plunge rate of automatic feeds, relative to the feed rate.
+const PlungeRatio = 0.5
+
+// DrillChiploadRatio is the chipload of a drill relative to a router bit of the same diameter, as a
+// drill takes its whole cut on the end.
+const DrillChiploadRatio = 0.25
+
+// ChiploadRange is the range of chiploads, in inches per tooth, a tool of the diameter cuts well at.
+type ChiploadRange struct {
+	Diameter float64
+	Min      float64
+	Max      float64
+}
+
+// ChiploadTable holds the chipload ranges by material core and then by tool material, in order of
+// increasing diameter.
+var ChiploadTable = map[string]map[string][]ChiploadRange{
+	"hardwood ply": {
+		"carbide": {
+			{Diameter: 0.125, Min: 0.003, Max: 0.005},
+			{Diameter: 0.25, Min: 0.009, Max: 0.011},
+			{Diameter: 0.375, Min: 0.013, Max: 0.015},
+			{Diameter: 0.5, Min: 0.015, Max: 0.018},
+			{Diameter: 0.625, Min: 0.018, Max: 0.020},
+		},
+	},
+	"mdf": {
+		"carbide": {
+			{Diameter: 0.125, Min: 0.004, Max: 0.006},
+			{Diameter: 0.25, Min: 0.010, Max: 0.012},
+			{Diameter: 0.375, Min: 0.015, Max: 0.017},
+			{Diameter: 0.5, Min: 0.018, Max: 0.020},
+			{Diameter: 0.625, Min: 0.020, Max: 0.022},
+		},
+	},
+	"hdf": {
+		"carbide": {
+			{Diameter: 0.125, Min: 0.003, Max: 0.005},
+			{Diameter: 0.25, Min: 0.008, Max: 0.010},
+			{Diameter: 0.375, Min: 0.012, Max: 0.014},
+			{Diameter: 0.5, Min: 0.015, Max: 0.017},
+			{Diameter: 0.625, Min: 0.017, Max: 0.019},
+		},
+	},
+	"particleboard": {
+		"carbide": {
+			{Diameter: 0.125, Min: 0.005, Max: 0.007},
+			{Diameter: 0.25, Min: 0.011, Max: 0.013},
+			{Diameter: 0.375, Min: 0.016, Max: 0.018},
+			{Diameter: 0.5, Min: 0.019, Max: 0.022},
+			{Diameter: 0.625, Min: 0.021, Max: 0.024},
+		},
+	},
+}
+
+// getChiploadRange returns the chipload range of the operation's tool in its material, interpolated
+// between the diameters of the table and scaled down for drills. It reports false if the table has
+// no entry for them.
+func getChiploadRange(toolop *ToolpathOperation) (ChiploadRange, bool) {
+	rng, ok := getRouterChiploadRange(toolop)
+	if ok && isDrill(toolop.Tool) {
+		rng.Min *= DrillChiploadRatio
+		rng.Max *= DrillChiploadRatio
+	}
+	return rng, ok
+}
+
+func getRouterChiploadRange(toolop *ToolpathOperation) (ChiploadRange, bool) {
+	if toolop.Tool == nil || toolop.Material == nil {
+		return ChiploadRange{}, false
+	}
+	rows := ChiploadTable[strings.ToLower(toolop.Material.Core)][strings.ToLower(toolop.Tool.Material)]
+	if len(rows) == 0 {
+		return ChiploadRange{}, false
+	}
+
+	d := toolop.Tool.CutDiameter
+	if d <= rows[0].Diameter {
+		return rows[0], true
+	}
+	for i := 1; i < len(rows); i++ {
+		if d <= rows[i].Diameter {
+			a, b := rows[i-1], rows[i]
+			t := (d - a.Diameter) / (b.Diameter - a.Diameter)
+			return ChiploadRange{
+				Diameter: d,
+				Min:      a.Min + (b.Min-a.Min)*t,
+				Max:      a.Max + (b.Max-a.Max)*t,
+			}, true
+		}
+	}
+	return rows[len(rows)-1], true
+}
+
+// getSpindleRPM returns the spindle speed automatic feeds run the operation's tool at.
+func getSpindleRPM(toolop *ToolpathOperation) int {
+	if toolop.Tool.MaxRPM > 0 {
+		return min(toolop.Tool.MaxRPM, DefaultSpindleRPM)
+	}
+	return DefaultSpindleRPM
+}
+
+// applyFeeds gives an operation with automatic feeds the spindle speed and feed rates that put its
+// tool in the middle of its chipload range. The operation is copied, since operations split by tool
+// share it. The error reports an operation whose feeds are left as set, for want of a chipload.
+func applyFeeds(toolop *ToolpathOperation) error {
+	if toolop.Operation.Feeds != FeedsAuto || len(toolop.Gang) > 0 {
+		// the gang drill's bits run at the feeds set
+		return nil
+	}
+	rng, ok := getChiploadRange(toolop)
+	if !ok {
+		return fmt.Errorf("operation %s: no chipload is known for the tool and material, feeds are left as set", toolop.Operation.Name)
+	}
+
+	rpm := getSpindleRPM(toolop)
+	feed := float64(rpm*max(toolop.Tool.Flutes, 1)) * (rng.Min + rng.Max) * 0.5
+	op := *toolop.Operation
+	op.SpindleRPM = rpm
+	op.FeedRate = int(math.Round(feed))
+	op.PlungeRate = int(math.Round(feed * PlungeRatio))
+	if isDrill(toolop.Tool) {
+		// drills only plunge
+		op.PlungeRate = op.FeedRate
+	}
+	toolop.Operation = &op
+	return nil
+}
+
+// checkFeeds slows an operation running its tool faster than the tool allows down to the tool's
+// limit. The operation is copied, since operations split by tool share it. The error reports the
+// speed it was slowed from.
+func checkFeeds(toolop *ToolpathOperation) error {
+	if toolop.Tool == nil {
+		return nil
+	}
+	if toolop.Tool.MaxRPM > 0 && toolop.Operation.SpindleRPM > toolop.Tool.MaxRPM {
+		op := *toolop.Operation
+		op.SpindleRPM = toolop.Tool.MaxRPM
+		err := fmt.Errorf("operation %s: spindle speed %d exceeds the %d rpm limit of %s, running at the limit",
+			op.Name, toolop.Operation.SpindleRPM, op.SpindleRPM, toolop.Tool.Name)
+		toolop.Operation = &op
+		return err
+	}
+	return nil
+}
+
+// checkChipload reports the operation running its tool at a chipload outside the range for its tool
+// and material: too low and the tool rubs and burns, too high and it chips and breaks.
+func checkChipload(toolop *ToolpathOperation) error {
+	op := toolop.Operation
+	if toolop.Tool == nil {
+		return nil
+	}
+	feed := float64(op.FeedRate)
+	if isDrill(toolop.Tool) {
+		feed = getDrillFeed(op)
+	}
+	if rng, ok := getChiploadRange(toolop); ok && op.SpindleRPM > 0 && feed > 0 {
+		chipload := feed / float64(op.SpindleRPM*max(toolop.Tool.Flutes, 1))
+		if chipload < rng.Min || chipload > rng.Max {
+			return fmt.Errorf("operation %s: chipload %.4f of %s is outside its %.4f to %.4f range",
+				op.Name, chipload, toolop.Tool.Name, rng.Min, rng.Max)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package toolpath
+
+import (
+	"testing"
+
+	"github.com/029614/gcode_lang/internal/data"
+)
+
+func TestCheckFeeds(t *testing.T) {
+	tests := []struct {
+		name   string
+		rpm    int
+		maxRPM int // of the tool, 0 for no limit
+		want   int // the speed run at
+		warned bool
+	}{
+		{"under the limit", 12000, 15000, 12000, false},
+		{"at the limit", 15000, 15000, 15000, false},
+		{"over the limit", 18000, 15000, 15000, true},
+		{"no limit", 24000, 0, 24000, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := testCut()
+			op.SpindleRPM = tt.rpm
+			tool := testTool()
+			tool.MaxRPM = tt.maxRPM
+			toolop := &ToolpathOperation{Operation: op, Tool: tool}
+
+			err := checkFeeds(toolop)
+			if (err != nil) != tt.warned {
+				t.Errorf("checkFeeds = %v, want a warning %v", err, tt.warned)
+			}
+			if toolop.Operation.SpindleRPM != tt.want {
+				t.Errorf("runs at %d rpm, want %d", toolop.Operation.SpindleRPM, tt.want)
+			}
+			if op.SpindleRPM != tt.rpm {
+				t.Errorf("the shared operation was changed to %d rpm", op.SpindleRPM)
+			}
+		})
+	}
+}
+
+// TestResourceSpindleSpeeds checks every operation of the repository's data runs its tool within
+// the tool's speed limit.
+func TestResourceSpindleSpeeds(t *testing.T) {
+	var ops data.OperationLibrary
+	var tools data.ToolLibrary
+	loadResource(t, "operations.json", &ops)
+	loadResource(t, "toollib.json", &tools)
+	for _, op := range ops {
+		tool, err := tools.GetToolByID(op.Tool)
+		if err != nil {
+			continue
+		}
+		if tool.MaxRPM > 0 && op.SpindleRPM > tool.MaxRPM {
+			t.Errorf("operation %s runs at %d rpm, over the %d rpm limit of %s", op.Name, op.SpindleRPM, tool.MaxRPM, tool.Name)
+		}
+	}
+}
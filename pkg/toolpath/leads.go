@@ -0,0 +1,297 @@
+package toolpath
+
+import (
+	"math"
+
+	nestparser "github.com/029614/gcode_lang/internal/parser/nest"
+	"github.com/029614/gcode_lang/internal/path"
+	"github.com/Anaxarchus/zero-gdscript/pkg/geometry2d"
+	"github.com/Anaxarchus/zero-gdscript/pkg/rect2"
+	"github.com/Anaxarchus/zero-gdscript/pkg/vector2"
+)
+
+// Lead shapes of data.Operation.LeadIn and LeadOut.
+const (
+	LeadNone = ""
+	LeadArc  = "arc"
+	LeadLine = "line"
+	LeadRamp = "ramp"
+)
+
+// Start points of data.Operation.StartPoint.
+const (
+	StartFirst   = ""
+	StartLongest = "longest"
+	StartCorner  = "corner"
+	StartPoint   = "point"
+)
+
+// CornerAngle is the least turn, in radians, at a vertex that makes it a corner.
+const CornerAngle = math.Pi / 6
+
+// LeadAttempts is the number of times a lead that hits a part is halved before it is dropped.
+const LeadAttempts = 4
+
+// getStartDistance returns the distance along a closed chain its cut starts at.
+func (toolop *ToolpathOperation) getStartDistance(ins *nestparser.Operation, w *chainWalker) float64 {
+	switch toolop.Operation.StartPoint {
+	case StartLongest:
+		best, res := -1.0, 0.0
+		var d float64
+		for i := 0; i < w.segmentCount(); i++ {
+			l := w.segmentLength(i)
+			if l > best {
+				best = l
+				res = d + l*0.5
+			}
+			d += l
+		}
+		return res
+	case StartCorner:
+		from := vector2.Zero()
+		if n := len(toolop.Toolpath); n > 0 {
+			from = vector2.New(toolop.Toolpath[n-1][0], toolop.Toolpath[n-1][1])
+		}
+		best, res := math.Inf(1), 0.0
+		var d float64
+		for i := 0; i < w.segmentCount(); i++ {
+			prev, corner := w.segment((i + w.segmentCount() - 1) % w.segmentCount())
+			_, next := w.segment(i)
+			turn := math.Abs(prev.DirectionTo(corner).AngleTo(corner.DirectionTo(next)))
+			if dd := from.DistanceSquaredTo(corner); turn >= CornerAngle && dd < best {
+				best = dd
+				res = d
+			}
+			d += w.segmentLength(i)
+		}
+		return res
+	case StartPoint:
+		pos := vector2.New(toolop.Operation.StartPosition[0], toolop.Operation.StartPosition[1])
+		if ins.Part != nil {
+			pos = ins.Part.Place(pos)
+		}
+		return w.project(pos)
+	default:
+		return 0.0
+	}
+}
+
+// startingAt returns a walker over the same closed chain that starts at distance d along it.
+func (w *chainWalker) startingAt(d float64) *chainWalker {
+	if d <= 1e-9 || d >= w.length()-1e-9 {
+		return w
+	}
+	pts := []vector2.Vector2{w.positionAt(d)}
+	var travelled float64
+	for i := 0; i < w.segmentCount(); i++ {
+		travelled += w.segmentLength(i)
+		if travelled > d {
+			for k := 1; k <= w.segmentCount(); k++ {
+				pts = append(pts, w.points[(i+k)%len(w.points)])
+			}
+			break
+		}
+	}
+	return newChainWalker(pts, true)
+}
+
+// directionAt returns the direction of travel at distance d along a closed chain.
+func (w *chainWalker) directionAt(d float64) vector2.Vector2 {
+	d = math.Mod(math.Mod(d, w.total)+w.total, w.total)
+	for i := 0; i < w.segmentCount(); i++ {
+		l := w.segmentLength(i)
+		if d < l || i == w.segmentCount()-1 {
+			a, b := w.segment(i)
+			return a.DirectionTo(b)
+		}
+		d -= l
+	}
+	return vector2.Zero()
+}
+
+// getLeads returns the lead in to the start of w and the lead out from the end of the overlap,
+// kept off the part. Leads that would cut into the part or a neighbouring part are shortened, and
+// dropped if they still don't fit. The lead in ends, and the lead out starts, on the chain.
+func (toolop *ToolpathOperation) getLeads(ins *nestparser.Operation, w *chainWalker, inside bool) ([]vector2.Vector2, []vector2.Vector2) {
+	op := toolop.Operation
+	if op.LeadLength <= 0 || (op.LeadIn == LeadNone && op.LeadOut == LeadNone) {
+		return nil, nil
+	}
+	start := w.pos
+	end := w.positionAt(op.Overlap)
+	away := leadSide(w, inside)
+
+	var in, out []vector2.Vector2
+	length := op.LeadLength
+	for i := 0; i < LeadAttempts && in == nil && op.LeadIn != LeadNone; i++ {
+		if lead := leadIn(op.LeadIn, start, w.directionAt(0), away, length); toolop.isLeadClear(ins, lead, inside) {
+			in = lead
+		}
+		length *= 0.5
+	}
+	length = op.LeadLength
+	for i := 0; i < LeadAttempts && out == nil && op.LeadOut != LeadNone; i++ {
+		if lead := leadOut(op.LeadOut, end, w.directionAt(op.Overlap), away, length); toolop.isLeadClear(ins, lead, inside) {
+			out = lead
+		}
+		length *= 0.5
+	}
+	return in, out
+}
+
+// leadSide returns the unit normal at the start of a closed chain that points away from the part:
+// out of perimeters and into cutouts.
+func leadSide(w *chainWalker, inside bool) vector2.Vector2 {
+	dir := w.directionAt(0)
+	away := vector2.New(-dir.Y, dir.X)
+	probe := w.pos.Add(away.Mulf(1e-4))
+	if path.PointInPolygon(probe, w.points) != inside {
+		away = away.Mulf(-1)
+	}
+	return away
+}
+
+// leadIn returns the points of a lead of the shape onto start, arriving travelling in dir.
+func leadIn(shape string, start, dir, away vector2.Vector2, length float64) []vector2.Vector2 {
+	switch shape {
+	case LeadArc:
+		center := start.Add(away.Mulf(length))
+		return arcPoints(center, center.Sub(dir.Mulf(length)), start)
+	case LeadLine:
+		return []vector2.Vector2{start.Add(away.Mulf(length)), start}
+	case LeadRamp:
+		return []vector2.Vector2{start.Add(away.Sub(dir).Normalized().Mulf(length)), start}
+	default:
+		return nil
+	}
+}
+
+// leadOut returns the points of a lead of the shape off end, leaving travelling in dir.
+func leadOut(shape string, end, dir, away vector2.Vector2, length float64) []vector2.Vector2 {
+	switch shape {
+	case LeadArc:
+		center := end.Add(away.Mulf(length))
+		return arcPoints(center, end, center.Add(dir.Mulf(length)))
+	case LeadLine:
+		return []vector2.Vector2{end, end.Add(away.Mulf(length))}
+	case LeadRamp:
+		return []vector2.Vector2{end, end.Add(away.Add(dir).Normalized().Mulf(length))}
+	default:
+		return nil
+	}
+}
+
+// arcPoints returns the points of the shorter arc about center from one point to another.
+func arcPoints(center, from, to vector2.Vector2) []vector2.Vector2 {
+	a := from.Sub(center)
+	b := to.Sub(center)
+	sweep := math.Atan2(a.Cross(b), a.Dot(b))
+	steps := arcSteps(a.Length(), sweep)
+	pts := []vector2.Vector2{from}
+	for i := 1; i < steps; i++ {
+		pts = append(pts, center.Add(rotate(a, sweep*float64(i)/float64(steps))))
+	}
+	return append(pts, to)
+}
+
+// isLeadClear reports whether the tool can follow a lead without touching the part it belongs to or
+// any other part on the sheet, going by their outlines, so leads can reach into the part gap beside
+// concave parts. Leads into cutouts must stay a tool radius inside them.
+func (toolop *ToolpathOperation) isLeadClear(ins *nestparser.Operation, lead []vector2.Vector2, inside bool) bool {
+	radius := 0.0
+	if toolop.Tool != nil {
+		radius = toolop.Tool.CutDiameter * 0.5
+	}
+	// the ends on the chain are where the tool cuts anyway
+	const tolerance = 1e-4
+
+	var cutout []vector2.Vector2
+	if inside {
+		if p := getPath(ins); p != nil {
+			cutout = p.Points
+		}
+	}
+	for i := 0; i+1 < len(lead); i++ {
+		for _, pt := range sampleSegment(lead[i], lead[i+1], math.Max(radius*0.25, 0.01)) {
+			if cutout != nil {
+				if !path.PointInPolygon(pt, cutout) || distanceToChain(pt, cutout) < radius-tolerance {
+					return false
+				}
+				continue
+			}
+			for _, part := range toolop.Parts {
+				// parts whose rectangle is out of reach can't be touched
+				if distanceToRect(pt, placedRect(part)) >= radius-tolerance {
+					continue
+				}
+				for _, outline := range partOutlines(part) {
+					if path.PointInPolygon(pt, outline) || distanceToChain(pt, outline) < radius-tolerance {
+						return false
+					}
+				}
+			}
+		}
+	}
+	return true
+}
+
+func sampleSegment(a, b vector2.Vector2, step float64) []vector2.Vector2 {
+	n := int(math.Ceil(a.DistanceTo(b) / step))
+	pts := make([]vector2.Vector2, 0, n+1)
+	for i := 0; i <= n; i++ {
+		pts = append(pts, a.Add(b.Sub(a).Mulf(float64(i)/float64(max(n, 1)))))
+	}
+	return pts
+}
+
+func distanceToChain(pt vector2.Vector2, points []vector2.Vector2) float64 {
+	best := math.Inf(1)
+	for i := range points {
+		seg := [2]vector2.Vector2{points[i], points[(i+1)%len(points)]}
+		best = math.Min(best, pt.DistanceTo(geometry2d.GetClosestPointToSegment(pt, seg)))
+	}
+	return best
+}
+
+// distanceToRect returns how far pt is outside the rectangle, or 0 if it is within it.
+func distanceToRect(pt vector2.Vector2, rect Rect2) float64 {
+	end := rect.Position.Add(rect.Size)
+	dx := math.Max(math.Max(rect.Position.X-pt.X, pt.X-end.X), 0)
+	dy := math.Max(math.Max(rect.Position.Y-pt.Y, pt.Y-end.Y), 0)
+	return math.Hypot(dx, dy)
+}
+
+// partOutlines returns the outlines of a placed part: its closed PartCut chains that aren't inside
+// another, or its rectangle when it has none.
+func partOutlines(part *nestparser.Part) [][]vector2.Vector2 {
+	var outlines [][]vector2.Vector2
+	for i := range part.Geometry.Chains {
+		ins := &part.Geometry.Chains[i]
+		if ins.Operation != PartCutOperation || isInsideChain(ins) {
+			continue
+		}
+		if p := getPath(ins); p != nil && p.Closed {
+			outlines = append(outlines, p.Points)
+		}
+	}
+	if len(outlines) == 0 {
+		rect := placedRect(part)
+		end := rect.Position.Add(rect.Size)
+		outlines = append(outlines, []vector2.Vector2{
+			rect.Position,
+			vector2.New(end.X, rect.Position.Y),
+			end,
+			vector2.New(rect.Position.X, end.Y),
+		})
+	}
+	return outlines
+}
+
+// placedRect returns the rectangle a part takes up on its sheet.
+func placedRect(part *nestparser.Part) Rect2 {
+	size := part.Size
+	if part.IsRotated == 1 {
+		size = vector2.New(size.Y, size.X)
+	}
+	return rect2.New(part.Origin, size)
+}
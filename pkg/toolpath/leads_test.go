@@ -0,0 +1,123 @@
+package toolpath
+
+import (
+	"math"
+	"testing"
+
+	nestparser "github.com/029614/gcode_lang/internal/parser/nest"
+	"github.com/Anaxarchus/zero-gdscript/pkg/vector2"
+)
+
+func TestLeadShapes(t *testing.T) {
+	const length = 0.5
+	start, dir, away := vector2.New(1, 1), vector2.New(1, 0), vector2.New(0, -1)
+	tests := []struct {
+		shape string
+		reach float64 // how far the lead's far end is from the chain
+	}{
+		{LeadLine, length},
+		{LeadArc, length},
+		{LeadRamp, length * math.Sqrt2 / 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.shape, func(t *testing.T) {
+			in := leadIn(tt.shape, start, dir, away, length)
+			if len(in) < 2 || !near(in[len(in)-1], start) {
+				t.Fatalf("lead in %v doesn't end on %v", in, start)
+			}
+			if got := in[0].Sub(start).Dot(away); math.Abs(got-tt.reach) > testTolerance {
+				t.Errorf("lead in comes from %v off the chain, want %v", got, tt.reach)
+			}
+
+			out := leadOut(tt.shape, start, dir, away, length)
+			if len(out) < 2 || !near(out[0], start) {
+				t.Fatalf("lead out %v doesn't start on %v", out, start)
+			}
+			if got := out[len(out)-1].Sub(start).Dot(away); math.Abs(got-tt.reach) > testTolerance {
+				t.Errorf("lead out goes %v off the chain, want %v", got, tt.reach)
+			}
+
+			// arcs join the chain tangent to it, so the tool doesn't stop
+			if tt.shape == LeadArc {
+				if got := in[len(in)-2].DirectionTo(in[len(in)-1]); got.Dot(dir) < math.Cos(0.1) {
+					t.Errorf("arc lead in arrives heading %v, want %v", got, dir)
+				}
+				if got := out[0].DirectionTo(out[1]); got.Dot(dir) < math.Cos(0.1) {
+					t.Errorf("arc lead out leaves heading %v, want %v", got, dir)
+				}
+			}
+		})
+	}
+	if leadIn(LeadNone, start, dir, away, length) != nil || leadOut(LeadNone, start, dir, away, length) != nil {
+		t.Error("leads without a shape")
+	}
+}
+
+// testLeads returns the leads of the instance as toolpathClosedOffset gets them.
+func testLeads(toolop *ToolpathOperation, ins *nestparser.Operation) ([]vector2.Vector2, []vector2.Vector2) {
+	inside := isInsideChain(ins)
+	p := orientClosed(toolop, getPath(ins).Offset(getClosedCompensation(toolop, inside), true), inside)
+	w := newChainWalker(p.Points, true)
+	w = w.startingAt(toolop.getStartDistance(ins, w))
+	return toolop.getLeads(ins, w, inside)
+}
+
+func TestGetLeads(t *testing.T) {
+	tests := []struct {
+		name   string
+		gap    float64 // the gap to the parts around it
+		inside bool    // lead into the cutout rather than onto the perimeter
+		length float64 // the length of the leads, or 0 if they are dropped
+	}{
+		{"clear", 5, false, 1},
+		{"close neighbours", 0.8, false, 0.5},
+		{"touching neighbours", 0.05, false, 0},
+		{"into a cutout", 5, true, 0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := testCut()
+			op.LeadIn, op.LeadOut, op.LeadLength = LeadLine, LeadLine, 1
+			op.StartPoint = StartLongest
+			origin, size := vector2.New(10, 10), vector2.New(10, 10)
+			part := testPart("part", origin, size,
+				rectChain(PartCutOperation, vector2.New(4, 4), vector2.New(1.2, 1.2)))
+			// parts on every side, the gap away
+			g := tt.gap
+			parts := []*nestparser.Part{
+				part,
+				testPart("left", vector2.New(origin.X-g-5, 0), vector2.New(5, 30)),
+				testPart("right", vector2.New(origin.X+size.X+g, 0), vector2.New(5, 30)),
+				testPart("below", vector2.New(0, origin.Y-g-5), vector2.New(30, 5)),
+				testPart("above", vector2.New(0, origin.Y+size.Y+g), vector2.New(30, 5)),
+			}
+			toolop := testOperation(op, testTool(), parts...)
+			ins := &part.Geometry.Chains[0]
+			if tt.inside {
+				ins = &part.Geometry.Chains[1]
+			}
+
+			in, out := testLeads(toolop, ins)
+			if tt.length == 0 {
+				if in != nil || out != nil {
+					t.Errorf("leads %v and %v, want them dropped", in, out)
+				}
+				return
+			}
+			if in == nil || out == nil {
+				t.Fatalf("leads %v and %v, want both", in, out)
+			}
+			if got := polylineLength(in); math.Abs(got-tt.length) > testTolerance {
+				t.Errorf("lead in is %v long, want %v", got, tt.length)
+			}
+			if got := polylineLength(out); math.Abs(got-tt.length) > testTolerance {
+				t.Errorf("lead out is %v long, want %v", got, tt.length)
+			}
+			for _, lead := range [][]vector2.Vector2{in, out} {
+				if !toolop.isLeadClear(ins, lead, tt.inside) {
+					t.Errorf("lead %v runs into a part", lead)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package toolpath
+
+import (
+	"sort"
+
+	nestparser "github.com/029614/gcode_lang/internal/parser/nest"
+	"github.com/Anaxarchus/zero-gdscript/pkg/rect2"
+	"github.com/Anaxarchus/zero-gdscript/pkg/vector2"
+)
+
+// PartCutOperation is the name of the operation that cuts parts free of the sheet.
+const PartCutOperation = "PartCut"
+
+// splitOnion moves the instances of parts that should be onion skinned out of a PartCut operation.
+// The onion operation cuts those parts down to the material's skin thickness above the spoilboard,
+// and the skin operation removes the skin afterwards, largest part first so the smallest parts come
+// free last. Both are nil when the operation, or its material, doesn't onion skin.
+func splitOnion(toolop *ToolpathOperation) (*ToolpathOperation, *ToolpathOperation) {
+	if toolop.Operation.Name != PartCutOperation || toolop.Material == nil || toolop.Material.OnionSkin <= 0 {
+		return nil, nil
+	}
+	skinDepth := toolop.Material.OnionSkin
+	if skinDepth <= toolop.Operation.CutDepth || skinDepth >= toolop.Operation.CutHeight {
+		return nil, nil
+	}
+
+	var keep, onioned []*nestparser.Operation
+	for _, ins := range toolop.Instance {
+		if ins.Part != nil && shouldOnion(getPartRect(ins.Part)) {
+			onioned = append(onioned, ins)
+		} else {
+			keep = append(keep, ins)
+		}
+	}
+	if len(onioned) == 0 {
+		return nil, nil
+	}
+	toolop.Instance = keep
+
+	onionOp := *toolop.Operation
+	onionOp.CutDepth = skinDepth
+	onion := &ToolpathOperation{
+		Operation: &onionOp,
+		Tool:      toolop.Tool,
+		Slot:      toolop.Slot,
+		Material:  toolop.Material,
+		Z:         toolop.Z,
+		Parts:     toolop.Parts,
+		Instance:  onioned,
+	}
+
+	// the skin pass starts in the already cut slot and takes the remaining depth
+	skinOp := *toolop.Operation
+	skinOp.CutHeight = skinDepth
+	skinOp.FinishPassDepth = 0
+	skinInstances := make([]*nestparser.Operation, len(onioned))
+	copy(skinInstances, onioned)
+	sort.SliceStable(skinInstances, func(i, j int) bool {
+		return partArea(skinInstances[i].Part) > partArea(skinInstances[j].Part)
+	})
+	skin := &ToolpathOperation{
+		Operation: &skinOp,
+		Tool:      toolop.Tool,
+		Slot:      toolop.Slot,
+		Material:  toolop.Material,
+		Z:         toolop.Z,
+		Parts:     toolop.Parts,
+		Instance:  skinInstances,
+	}
+
+	return onion, skin
+}
+
+func getPartRect(part *nestparser.Part) Rect2 {
+	return rect2.New(vector2.Zero(), part.Size)
+}
+
+func partArea(part *nestparser.Part) float64 {
+	return part.Size.X * part.Size.Y
+}
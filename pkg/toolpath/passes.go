@@ -0,0 +1,143 @@
+package toolpath
+
+import (
+	"math"
+
+	nestparser "github.com/029614/gcode_lang/internal/parser/nest"
+)
+
+// Pass is a single depth level of a cut and the feed rate it runs at.
+type Pass struct {
+	Depth float64
+	Feed  float64
+}
+
+// getMaxPassDepth returns the deepest single pass allowed for the operation, or 0 if unlimited.
+// The operation setting wins over the tool setting, and both are capped by the tool's cutting
+// length and the material thickness.
+func getMaxPassDepth(toolop *ToolpathOperation) float64 {
+	var limits []float64
+	if toolop.Operation.MaxPassDepth > 0 {
+		limits = append(limits, toolop.Operation.MaxPassDepth)
+	} else if toolop.Tool != nil && toolop.Tool.MaxPassDepth > 0 {
+		limits = append(limits, toolop.Tool.MaxPassDepth)
+	}
+	if toolop.Tool != nil && toolop.Tool.CutLength > 0 {
+		limits = append(limits, toolop.Tool.CutLength)
+	}
+	if toolop.Material != nil && toolop.Material.Thickness() > 0 {
+		limits = append(limits, toolop.Material.Thickness())
+	}
+
+	maxDepth := 0.0
+	for _, l := range limits {
+		if maxDepth == 0 || l < maxDepth {
+			maxDepth = l
+		}
+	}
+	return maxDepth
+}
+
+// PassSplit shares the passes of a cut between a roughing and a finishing tool.
+type PassSplit struct {
+	Depth  float64 // the depth the roughing passes stop at and the finishing passes start from
+	Finish bool    // the operation cuts the finishing passes, below Depth
+}
+
+// getPasses splits the cut from CutHeight down to CutDepth into evenly sized roughing passes
+// no deeper than getMaxPassDepth, followed by the optional finish pass. A cut split between tools
+// takes only its share of the depth, and the finish pass is left to the finishing tool.
+func getPasses(toolop *ToolpathOperation) []Pass {
+	op := toolop.Operation
+	height, depth, finishDepth := op.CutHeight, op.CutDepth, op.FinishPassDepth
+	if split := toolop.Split; split != nil {
+		if split.Finish {
+			height = split.Depth
+		} else {
+			depth, finishDepth = split.Depth, 0
+		}
+	}
+
+	feed := float64(op.FeedRate)
+	total := height - depth
+	if total <= 0 {
+		return []Pass{{Depth: depth, Feed: feed}}
+	}
+
+	finish := 0.0
+	if finishDepth > 0 && finishDepth < total {
+		finish = finishDepth
+	}
+	rough := total - finish
+
+	count := 1
+	if maxDepth := getMaxPassDepth(toolop); maxDepth > 0 {
+		count = int(math.Ceil(rough/maxDepth - 1e-9))
+	}
+
+	passes := make([]Pass, 0, count+1)
+	for i := 1; i <= count; i++ {
+		passes = append(passes, Pass{
+			Depth: height - rough*float64(i)/float64(count),
+			Feed:  feed,
+		})
+	}
+
+	if finish > 0 {
+		finishFeed := feed
+		if op.FinishFeedRate > 0 {
+			finishFeed = float64(op.FinishFeedRate)
+		}
+		passes = append(passes, Pass{Depth: depth, Feed: finishFeed})
+	}
+	return passes
+}
+
+// getPassStart returns the Z the first pass of the operation cuts down from: CutHeight, or the
+// depth the roughing tool left the cut at for a finishing operation.
+func getPassStart(toolop *ToolpathOperation) float64 {
+	if toolop.Split != nil && toolop.Split.Finish {
+		return toolop.Split.Depth
+	}
+	return toolop.Operation.CutHeight
+}
+
+// getFinishAllowance returns the stock the roughing passes of a cut compensated by offset leave on
+// the wall, signed to move them further from it. Centre line cuts have no wall to finish.
+func getFinishAllowance(toolop *ToolpathOperation, offset float64) float64 {
+	if offset == 0 || toolop.Operation.FinishAllowance <= 0 {
+		return 0
+	}
+	return math.Copysign(toolop.Operation.FinishAllowance, offset)
+}
+
+// getFinishOperation returns a copy of the operation, with none of its toolpath, that takes off the
+// finish allowance at full depth, in as few passes as the tool can reach, at the finish feed rate.
+func getFinishOperation(toolop *ToolpathOperation) *ToolpathOperation {
+	op := *toolop.Operation
+	op.MaxPassDepth = op.CutHeight - op.CutDepth
+	op.FinishPassDepth = 0
+	if op.FinishFeedRate > 0 {
+		op.FeedRate = op.FinishFeedRate
+	}
+	fin := *toolop
+	fin.Operation = &op
+	fin.Toolpath, fin.Tabs, fin.Freed = nil, nil, nil
+	return &fin
+}
+
+// finishInstance returns a copy of the instance held by the tabs its roughing passes left, so the
+// finish pass leaves the same tabs.
+func finishInstance(ins *nestparser.Operation, placed []PlacedTab) *nestparser.Operation {
+	if len(placed) == 0 || ins.Part == nil {
+		return ins
+	}
+	part := *ins.Part
+	part.Tabs = make([]nestparser.Tab, len(placed))
+	for i, tab := range placed {
+		part.Tabs[i] = nestparser.Tab{Position: tab.Position, Width: tab.Width, Height: tab.Height}
+	}
+	fin := *ins
+	fin.Part = &part
+	return &fin
+}
@@ -0,0 +1,99 @@
+package toolpath
+
+import (
+	"math"
+	"testing"
+
+	"github.com/029614/gcode_lang/internal/data"
+)
+
+func TestGetPasses(t *testing.T) {
+	tests := []struct {
+		name   string
+		set    func(toolop *ToolpathOperation)
+		depths []float64
+		feeds  []float64
+	}{
+		{"limited by the operation", func(toolop *ToolpathOperation) {}, []float64{0.5, 0.25, 0}, nil},
+		{"limited by the tool", func(toolop *ToolpathOperation) {
+			toolop.Operation.MaxPassDepth = 0
+			toolop.Tool.MaxPassDepth = 0.4
+		}, []float64{0.375, 0}, nil},
+		{"limited by the cut length", func(toolop *ToolpathOperation) {
+			toolop.Operation.MaxPassDepth = 0
+			toolop.Tool.CutLength = 0.5
+		}, []float64{0.375, 0}, nil},
+		{"unlimited", func(toolop *ToolpathOperation) {
+			toolop.Operation.MaxPassDepth = 0
+			toolop.Tool.CutLength = 0
+		}, []float64{0}, nil},
+		{"exact passes", func(toolop *ToolpathOperation) { toolop.Operation.MaxPassDepth = 0.25 }, []float64{0.5, 0.25, 0}, nil},
+		{"finish pass", func(toolop *ToolpathOperation) {
+			toolop.Operation.FinishPassDepth = 0.05
+			toolop.Operation.FinishFeedRate = 300
+		}, []float64{0.75 - 0.7/3, 0.75 - 1.4/3, 0.05, 0}, []float64{600, 600, 600, 300}},
+		{"finish pass deeper than the cut", func(toolop *ToolpathOperation) { toolop.Operation.FinishPassDepth = 1 }, []float64{0.5, 0.25, 0}, nil},
+		{"roughing share", func(toolop *ToolpathOperation) {
+			toolop.Operation.FinishPassDepth = 0.05
+			toolop.Split = &PassSplit{Depth: 0.25}
+		}, []float64{0.5, 0.25}, nil},
+		{"finishing share", func(toolop *ToolpathOperation) {
+			toolop.Operation.FinishPassDepth = 0.05
+			toolop.Operation.FinishFeedRate = 300
+			toolop.Split = &PassSplit{Depth: 0.25, Finish: true}
+		}, []float64{0.05, 0}, []float64{600, 300}},
+		{"nothing to cut", func(toolop *ToolpathOperation) { toolop.Operation.CutDepth = 0.75 }, []float64{0.75}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := testCut()
+			tool := testTool()
+			toolop := &ToolpathOperation{Operation: op, Tool: tool}
+			tt.set(toolop)
+
+			passes := getPasses(toolop)
+			if len(passes) != len(tt.depths) {
+				t.Fatalf("passes %v, want depths %v", passes, tt.depths)
+			}
+			z := getPassStart(toolop)
+			for i, pass := range passes {
+				if math.Abs(pass.Depth-tt.depths[i]) > testTolerance {
+					t.Errorf("pass %d at %v, want %v", i, pass.Depth, tt.depths[i])
+				}
+				if max := getMaxPassDepth(toolop); max > 0 && z-pass.Depth > max+testTolerance {
+					t.Errorf("pass %d takes %v, more than %v", i, z-pass.Depth, max)
+				}
+				want := float64(op.FeedRate)
+				if tt.feeds != nil {
+					want = tt.feeds[i]
+				}
+				if pass.Feed != want {
+					t.Errorf("pass %d feeds at %v, want %v", i, pass.Feed, want)
+				}
+				z = pass.Depth
+			}
+		})
+	}
+}
+
+func TestGetFinishAllowance(t *testing.T) {
+	tests := []struct {
+		name      string
+		allowance float64
+		offset    float64
+		want      float64
+	}{
+		{"outward", 0.02, 0.125, 0.02},
+		{"inward", 0.02, -0.125, -0.02},
+		{"centre line", 0.02, 0, 0},
+		{"none", 0, 0.125, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			toolop := &ToolpathOperation{Operation: &data.Operation{FinishAllowance: tt.allowance}}
+			if got := getFinishAllowance(toolop, tt.offset); got != tt.want {
+				t.Errorf("getFinishAllowance = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
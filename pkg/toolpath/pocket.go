@@ -0,0 +1,310 @@
+package toolpath
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	nestparser "github.com/029614/gcode_lang/internal/parser/nest"
+	"github.com/029614/gcode_lang/internal/path"
+	"github.com/Anaxarchus/zero-gdscript/pkg/vector2"
+)
+
+// Pocket strategies of data.Operation.Strategy.
+const (
+	PocketStrategyOffset   = "offset"
+	PocketStrategyRaster   = "raster"
+	PocketStrategyAdaptive = "adaptive"
+)
+
+// DefaultStepover is the pocket stepover, as a percentage of the tool diameter, when the operation has none.
+const DefaultStepover = 40.0
+
+// DefaultPocketRampAngle is the entry ramp angle, in degrees, of pockets whose operation has no ramp.
+// Pockets never plunge straight in.
+const DefaultPocketRampAngle = 5.0
+
+// pocketRegion is a closed boundary to clear, less the islands inside it.
+type pocketRegion struct {
+	boundary []vector2.Vector2
+	islands  [][]vector2.Vector2
+	part     *nestparser.Part
+}
+
+func toolpathPocket(toolop *ToolpathOperation) error {
+	if toolop.Tool == nil {
+		return fmt.Errorf("operation %s: pocketing needs a tool", toolop.Operation.Name)
+	}
+	radius := toolop.Tool.CutDiameter * 0.5
+	step := getStepover(toolop)
+
+	for _, region := range getRegions(toolop) {
+		start := len(toolop.Toolpath)
+		toolpathRegion(toolop, region, radius, step)
+		toolop.reduceFeeds(start, region.part)
+		toolop.Spans = append(toolop.Spans, PartSpan{Part: region.part, From: start, To: len(toolop.Toolpath)})
+	}
+	return nil
+}
+
+// toolpathRegion clears a pocket region with the operation's strategy.
+func toolpathRegion(toolop *ToolpathOperation, region pocketRegion, radius, step float64) {
+	if toolop.Previous != nil {
+		toolpathRest(toolop, region)
+		return
+	}
+	if toolop.Operation.Strategy == PocketStrategyAdaptive {
+		toolpathAdaptivePocket(toolop, region)
+		return
+	}
+
+	var loops, rows [][]vector2.Vector2
+	if toolop.Operation.Strategy == PocketStrategyRaster {
+		rows = rasterRows(region, radius+step*0.5, step, toolop.Operation.CutAngle*math.Pi/180.0)
+	} else {
+		loops = offsetLoops(region, radius, step)
+	}
+	walls := pocketWalls(toolop, region)
+
+	z := toolop.Operation.CutHeight
+	for _, pass := range getPasses(toolop) {
+		for _, row := range rows {
+			toolop.cutPocketRow(row, z, pass)
+		}
+		// contour loops run inside out, finishing on the walls
+		for _, loop := range loops {
+			toolop.cutPocketLoop(loop, z, pass)
+		}
+		for _, loop := range walls {
+			toolop.cutPocketLoop(loop, z, pass)
+		}
+		z = pass.Depth
+	}
+}
+
+// getStepover returns the distance between neighbouring pocket passes.
+func getStepover(toolop *ToolpathOperation) float64 {
+	stepover := toolop.Operation.Stepover
+	if stepover <= 0 || stepover > 100 {
+		stepover = DefaultStepover
+	}
+	return toolop.Tool.CutDiameter * stepover / 100.0
+}
+
+// getPocketRamp returns the distance travelled while ramping into a pocket from one height down to another.
+func getPocketRamp(toolop *ToolpathOperation, from, to float64) float64 {
+	angle := toolop.Operation.Ramp
+	if angle <= 0 {
+		angle = DefaultPocketRampAngle
+	}
+	if from <= to {
+		return 0.0
+	}
+	return getRampLength(to, from, angle*math.Pi/180.0)
+}
+
+// getRegions groups the closed chains of the operation by part, treating chains inside another
+// chain of the same part as islands of it.
+func getRegions(toolop *ToolpathOperation) []pocketRegion {
+	byPart := make(map[*nestparser.Part][][]vector2.Vector2)
+	var parts []*nestparser.Part
+	for _, ins := range toolop.Instance {
+		p := getPath(ins)
+		if p == nil || !p.Closed || len(p.Points) < 3 {
+			continue
+		}
+		if _, ok := byPart[ins.Part]; !ok {
+			parts = append(parts, ins.Part)
+		}
+		byPart[ins.Part] = append(byPart[ins.Part], p.Points)
+	}
+
+	var regions []pocketRegion
+	for _, part := range parts {
+		chains := byPart[part]
+		for i, chain := range chains {
+			if isInsideAny(chain, chains, i) {
+				continue
+			}
+			region := pocketRegion{boundary: chain, part: part}
+			for j, other := range chains {
+				if j != i && path.PointInPolygon(other[0], chain) {
+					region.islands = append(region.islands, other)
+				}
+			}
+			regions = append(regions, region)
+		}
+	}
+	return regions
+}
+
+func isInsideAny(chain []vector2.Vector2, chains [][]vector2.Vector2, self int) bool {
+	for j, other := range chains {
+		if j != self && path.PointInPolygon(chain[0], other) {
+			return true
+		}
+	}
+	return false
+}
+
+// offsetLoops returns the contour parallel loops clearing the region inside its walls, innermost first.
+func offsetLoops(region pocketRegion, radius, step float64) [][]vector2.Vector2 {
+	var levels [][][]vector2.Vector2
+	for delta := radius + step; ; delta += step {
+		level := path.OffsetRegion(region.boundary, region.islands, -delta, true)
+		if len(level) == 0 {
+			break
+		}
+		levels = append(levels, level)
+	}
+
+	var loops [][]vector2.Vector2
+	for i := len(levels) - 1; i >= 0; i-- {
+		loops = append(loops, levels[i]...)
+	}
+	return loops
+}
+
+// pocketWalls returns the loops that finish the walls of the region, a tool radius from them, with
+// the operation's corner relief. Offset loops wind with the wall on their right.
+func pocketWalls(toolop *ToolpathOperation, region pocketRegion) [][]vector2.Vector2 {
+	radius := toolop.Tool.CutDiameter * 0.5
+	walls := path.OffsetRegion(region.boundary, region.islands, -radius, true)
+	for i, loop := range walls {
+		walls[i] = relieveCorners(toolop, path.NewPath(loop, true), path.WallRight).Points
+	}
+	return walls
+}
+
+// rasterRows returns zig-zag passes at angle across the region shrunk by inset. Rows that follow on
+// from each other are linked into a single polyline so the tool stays down between them.
+func rasterRows(region pocketRegion, inset, step, angle float64) [][]vector2.Vector2 {
+	area := path.OffsetRegion(region.boundary, region.islands, -inset, true)
+	if len(area) == 0 {
+		return nil
+	}
+
+	// rotate the area so the rows run along X
+	rotated := make([][]vector2.Vector2, len(area))
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	for i, loop := range area {
+		rotated[i] = make([]vector2.Vector2, len(loop))
+		for j, pt := range loop {
+			r := rotate(pt, -angle)
+			rotated[i][j] = r
+			minY = math.Min(minY, r.Y)
+			maxY = math.Max(maxY, r.Y)
+		}
+	}
+
+	var rows [][]vector2.Vector2
+	var current []vector2.Vector2
+	var lastCount int
+	reverse := false
+	for y := minY + step*0.5; y < maxY; y += step {
+		spans := scanSpans(rotated, y)
+		for i := range spans {
+			a, b := spans[i][0], spans[i][1]
+			if reverse {
+				a, b = b, a
+			}
+			a, b = rotate(a, angle), rotate(b, angle)
+
+			// stay down when a single span follows a single span and the link stays inside the area
+			linked := len(current) > 0 && len(spans) == 1 && lastCount == 1 &&
+				current[len(current)-1].DistanceTo(a) <= step*2 &&
+				insideRegion(current[len(current)-1].Add(a).Mulf(0.5), area)
+			if !linked && len(current) > 0 {
+				rows = append(rows, current)
+				current = nil
+			}
+			current = append(current, a, b)
+		}
+		if len(spans) > 0 {
+			lastCount = len(spans)
+			reverse = !reverse
+		}
+	}
+	if len(current) > 0 {
+		rows = append(rows, current)
+	}
+	return rows
+}
+
+// scanSpans returns the pairs of points where the horizontal line at y enters and leaves the loops.
+func scanSpans(loops [][]vector2.Vector2, y float64) [][2]vector2.Vector2 {
+	var xs []float64
+	for _, loop := range loops {
+		for i := range loop {
+			a, b := loop[i], loop[(i+1)%len(loop)]
+			if (a.Y > y) != (b.Y > y) {
+				xs = append(xs, a.X+(y-a.Y)*(b.X-a.X)/(b.Y-a.Y))
+			}
+		}
+	}
+	sort.Float64s(xs)
+
+	var spans [][2]vector2.Vector2
+	for i := 0; i+1 < len(xs); i += 2 {
+		spans = append(spans, [2]vector2.Vector2{vector2.New(xs[i], y), vector2.New(xs[i+1], y)})
+	}
+	return spans
+}
+
+// rotate turns pt counter-clockwise about the origin. vector2.Rotated overwrites X before
+// computing Y, so it can't be used here.
+func rotate(pt vector2.Vector2, angle float64) vector2.Vector2 {
+	sin, cos := math.Sincos(angle)
+	return vector2.New(pt.X*cos-pt.Y*sin, pt.X*sin+pt.Y*cos)
+}
+
+// insideRegion reports whether pt lies inside the loops of an offset region, holes included.
+func insideRegion(pt vector2.Vector2, loops [][]vector2.Vector2) bool {
+	inside := false
+	for _, loop := range loops {
+		if path.PointInPolygon(pt, loop) {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// cutPocketLoop cuts one closed loop of a pocket at the pass depth, ramping in along the loop from z.
+func (toolop *ToolpathOperation) cutPocketLoop(loop []vector2.Vector2, z float64, pass Pass) {
+	w := newChainWalker(orientLoop(toolop, loop), true)
+	if w == nil {
+		return
+	}
+	toolop.addEntry(w.pos)
+	if z < toolop.Operation.CutHeight {
+		toolop.addPlunge(w.pos, z)
+	}
+
+	rampDist := getPocketRamp(toolop, z, pass.Depth)
+	toolop.addProfile(w, rampDist, pass.Feed, nil, nil, func(travel float64) float64 {
+		return z - (z-pass.Depth)*math.Min(travel/rampDist, 1.0)
+	})
+	toolop.addProfile(w, w.length(), pass.Feed, nil, nil, func(float64) float64 {
+		return pass.Depth
+	})
+	toolop.addRetract()
+}
+
+// cutPocketRow cuts one raster polyline at the pass depth, ramping back and forth along it from z.
+func (toolop *ToolpathOperation) cutPocketRow(row []vector2.Vector2, z float64, pass Pass) {
+	w := newChainWalker(row, false)
+	if w == nil {
+		return
+	}
+	start := w.pos
+	toolop.addEntry(start)
+	if z < toolop.Operation.CutHeight {
+		toolop.addPlunge(start, z)
+	}
+
+	rampDist := getPocketRamp(toolop, z, pass.Depth)
+	toolop.addRamp(start, w.walk(rampDist), rampDist, z, pass)
+	toolop.addCut(pass, w.toStart()...)
+	toolop.addCut(pass, w.points[1:]...)
+	toolop.addRetract()
+}
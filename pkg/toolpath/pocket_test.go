@@ -0,0 +1,88 @@
+package toolpath
+
+import (
+	"math"
+	"testing"
+
+	nestparser "github.com/029614/gcode_lang/internal/parser/nest"
+	"github.com/029614/gcode_lang/internal/path"
+	"github.com/Anaxarchus/zero-gdscript/pkg/geometry2d"
+	"github.com/Anaxarchus/zero-gdscript/pkg/vector2"
+)
+
+func TestToolpathPocket(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		island   bool
+	}{
+		{"offset", PocketStrategyOffset, false},
+		{"offset round an island", PocketStrategyOffset, true},
+		{"raster", PocketStrategyRaster, false},
+		{"raster round an island", PocketStrategyRaster, true},
+		{"adaptive", PocketStrategyAdaptive, false},
+		{"adaptive round an island", PocketStrategyAdaptive, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := testCut()
+			op.Name, op.Type, op.Strategy = "Pocket", "POCKET", tt.strategy
+			op.CutDepth, op.Offset = 0.5, ""
+			op.MaxPassDepth = 0.15
+			ops := []nestparser.Operation{rectChain("Pocket", vector2.New(2, 2), vector2.New(6, 4))}
+			if tt.island {
+				ops = append(ops, rectChain("Pocket", vector2.New(4, 3.5), vector2.New(1, 1)))
+			}
+			part := testPart("part", vector2.Zero(), vector2.New(10, 8), ops...)
+			toolop := testOperation(op, testTool(), part)
+			if err := toolpathPocket(toolop); err != nil {
+				t.Fatal(err)
+			}
+			if deepest := checkToolpath(t, toolop); math.Abs(deepest-op.CutDepth) > testTolerance {
+				t.Errorf("cuts down to %v, want the cut depth %v", deepest, op.CutDepth)
+			}
+
+			radius := toolop.Tool.CutDiameter * 0.5
+			boundary := getPath(&part.Geometry.Chains[1]).Points
+			var island []vector2.Vector2
+			if tt.island {
+				island = getPath(&part.Geometry.Chains[2]).Points
+			}
+			// clear of the walls
+			var floor [][2]vector2.Vector2
+			tp := toolop.Toolpath
+			for k, pt := range tp {
+				if pt[3] == 0 {
+					continue
+				}
+				pos := vector2.New(pt[0], pt[1])
+				if !path.PointInPolygon(pos, boundary) || distanceToChain(pos, boundary) < radius-1e-3 {
+					t.Errorf("point %d %v cuts the pocket's wall", k, pt)
+				}
+				if island != nil && (path.PointInPolygon(pos, island) || distanceToChain(pos, island) < radius-1e-3) {
+					t.Errorf("point %d %v cuts the island", k, pt)
+				}
+				if k > 0 && tp[k-1][3] != 0 && math.Abs(pt[2]-op.CutDepth) < testTolerance && math.Abs(tp[k-1][2]-op.CutDepth) < testTolerance {
+					floor = append(floor, [2]vector2.Vector2{vector2.New(tp[k-1][0], tp[k-1][1]), pos})
+				}
+			}
+
+			// and the whole floor cleared at the cut depth
+			for x := 2 + radius; x <= 8-radius; x += 0.2 {
+				for y := 2 + radius; y <= 6-radius; y += 0.2 {
+					pt := vector2.New(x, y)
+					if island != nil && (path.PointInPolygon(pt, island) || distanceToChain(pt, island) < radius) {
+						continue
+					}
+					best := math.Inf(1)
+					for _, seg := range floor {
+						best = math.Min(best, pt.DistanceTo(geometry2d.GetClosestPointToSegment(pt, seg)))
+					}
+					if best > radius+1e-3 {
+						t.Errorf("the floor at %v is left %v from the tool", pt, best-radius)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package toolpath
+
+import (
+	"math"
+
+	"github.com/029614/gcode_lang/internal/data"
+	"github.com/029614/gcode_lang/internal/path"
+	"github.com/Anaxarchus/zero-gdscript/pkg/rect2"
+	"github.com/Anaxarchus/zero-gdscript/pkg/vector2"
+)
+
+// FreedRegion is the bounding rectangle of a part, or of the scrap inside a cutout, that an operation
+// cut free, and the index of its toolpath from which it is loose.
+type FreedRegion struct {
+	Rect Rect2
+	From int
+}
+
+// frees reports whether cutting a closed chain of the operation cuts a region of the sheet loose:
+// whether it leaves less than the material's holding skin, or, when that isn't known, whether it is
+// closed at all. Chains cut with holding tabs, or only roughed for a finishing tool, stay attached.
+func frees(toolop *ToolpathOperation, tabs int) bool {
+	if len(toolop.Tabs) != tabs || (toolop.Split != nil && !toolop.Split.Finish) {
+		return false
+	}
+	if toolop.Material == nil || toolop.Material.HoldingSkin <= 0 {
+		return true
+	}
+	return toolop.Operation.CutDepth < toolop.Material.HoldingSkin
+}
+
+// chainRect returns the bounding rectangle of a chain.
+func chainRect(p *path.Path) Rect2 {
+	rect := rect2.New(p.Points[0], vector2.Zero())
+	for _, pt := range p.Points[1:] {
+		rect = rect.Expand(pt)
+	}
+	return rect
+}
+
+// isHop reports whether the toolpath leaves one feature at k, rising to a height, and travels to
+// the next one at that height.
+func isHop(tp []ToolpathPoint, k int) bool {
+	if k < 1 || k+1 >= len(tp) {
+		return false
+	}
+	retract, travel := tp[k], tp[k+1]
+	return retract[3] == 0 && travel[3] == 0 &&
+		retract[0] == tp[k-1][0] && retract[1] == tp[k-1][1] && retract[2] > tp[k-1][2] &&
+		travel[2] == retract[2] && (travel[0] != retract[0] || travel[1] != retract[1])
+}
+
+// isRapidClear reports whether the tool can travel between two points without passing over any of
+// the freed regions.
+func isRapidClear(from, to vector2.Vector2, freed []Rect2, margin float64) bool {
+	for _, pt := range sampleSegment(from, to, math.Max(margin*0.5, 0.05)) {
+		for _, rect := range freed {
+			if distanceToRect(pt, rect) < margin {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// planRapids lowers the travel between features of the sheet from FeedHeight to the router's
+// RapidClearance above the material top wherever the way doesn't cross a part or scrap that is
+// already cut free, which could have shifted or lifted. Travel between operations is only lowered
+// when they share a tool, as a tool change retracts fully. Routers without a RapidClearance always
+// travel at FeedHeight.
+func planRapids(sheet []*ToolpathOperation, top float64, router *data.Router) {
+	if router == nil || router.RapidClearance <= 0 {
+		return
+	}
+	low := top + router.RapidClearance
+	var freed []Rect2
+	lower := func(toolop *ToolpathOperation, a, b *ToolpathPoint) {
+		margin := router.RapidClearance
+		if toolop.Tool != nil {
+			margin += toolop.Tool.CutDiameter * 0.5
+		}
+		if low < a[2] && low < b[2] && isRapidClear(vector2.New(a[0], a[1]), vector2.New(b[0], b[1]), freed, margin) {
+			a[2], b[2] = low, low
+		}
+	}
+
+	for i, toolop := range sheet {
+		tp := toolop.Toolpath
+		next := 0
+		for k := range tp {
+			for next < len(toolop.Freed) && toolop.Freed[next].From <= k {
+				freed = append(freed, toolop.Freed[next].Rect)
+				next++
+			}
+			if isHop(tp, k) {
+				lower(toolop, &tp[k], &tp[k+1])
+			}
+		}
+		for ; next < len(toolop.Freed); next++ {
+			freed = append(freed, toolop.Freed[next].Rect)
+		}
+
+		if i+1 < len(sheet) && toolKey(sheet[i+1]) == toolKey(toolop) && len(tp) > 1 && len(sheet[i+1].Toolpath) > 0 {
+			following := sheet[i+1].Toolpath
+			if last := len(tp) - 1; tp[last][3] == 0 && tp[last][2] > tp[last-1][2] && following[0][2] == tp[last][2] {
+				lower(toolop, &tp[last], &following[0])
+			}
+		}
+	}
+}
+
+// getMaterialTop returns the Z of the top of the sheet, from its Z reference or else from the
+// highest operation start.
+func getMaterialTop(sheet []*ToolpathOperation, zref ZReference) float64 {
+	if zref.Thickness > 0 {
+		return zref.Thickness
+	}
+	var top float64
+	for _, toolop := range sheet {
+		top = math.Max(top, math.Max(toolop.Operation.CutHeight, toolop.Operation.DrillHeight))
+	}
+	return top
+}
+
+// RapidDistance returns the distance the sheet's toolpaths travel at rapid.
+func RapidDistance(sheet []*ToolpathOperation) float64 {
+	var d float64
+	var prev *ToolpathPoint
+	for _, toolop := range sheet {
+		for k := range toolop.Toolpath {
+			pt := &toolop.Toolpath[k]
+			if prev != nil && pt[3] == 0 {
+				d += math.Sqrt((pt[0]-prev[0])*(pt[0]-prev[0]) + (pt[1]-prev[1])*(pt[1]-prev[1]) + (pt[2]-prev[2])*(pt[2]-prev[2]))
+			}
+			prev = pt
+		}
+	}
+	return d
+}
+
+// nestedRapidDistance returns the distance the operations travel at rapid when cut in the order they
+// are nested, each followed by its cleanup and the skins last, retracting fully between features.
+// The operations are toolpathed afresh, leaving them as they are.
+func nestedRapidDistance(tops, skins []*ToolpathOperation, router *data.Router, tools *data.ToolLibrary) float64 {
+	var nested []*ToolpathOperation
+	cut := func(t *ToolpathOperation) {
+		c := *t
+		c.Toolpath, c.Tabs, c.Freed = nil, nil, nil
+		if c.toolpath() == nil {
+			nested = append(nested, &c)
+		}
+	}
+	for _, t := range tops {
+		if len(t.Instance) == 0 {
+			continue
+		}
+		cut(t)
+		if rest, _ := getRestOperation(t, router, tools); rest != nil {
+			applyFeeds(rest)
+			cut(rest)
+		}
+	}
+	for _, skin := range skins {
+		cut(skin)
+	}
+	return RapidDistance(nested)
+}
@@ -0,0 +1,34 @@
+package toolpath
+
+import (
+	"math"
+
+	"github.com/029614/gcode_lang/internal/path"
+)
+
+// DefaultReliefAngle is the largest interior angle, in degrees, of a relieved corner when the
+// operation sets none. It takes in square corners with some allowance for drawing error.
+const DefaultReliefAngle = 100.0
+
+// relieveCorners adds the operation's corner relief to a tool path with its wall on the given side.
+func relieveCorners(toolop *ToolpathOperation, p *path.Path, wall path.Wall) *path.Path {
+	if toolop.Operation.CornerRelief == "" || toolop.Tool == nil {
+		return p
+	}
+	angle := toolop.Operation.ReliefAngle
+	if angle <= 0 {
+		angle = DefaultReliefAngle
+	}
+	return p.CornerRelief(toolop.Operation.CornerRelief, toolop.Tool.CutDiameter*0.5, angle*math.Pi/180.0, wall)
+}
+
+// getWall returns the side of a compensated path its wall lies on, or both sides when it isn't
+// compensated and the tool cuts on the centre line.
+func getWall(offset float64, wallRight bool) path.Wall {
+	if offset == 0 {
+		return path.WallBoth
+	} else if wallRight {
+		return path.WallRight
+	}
+	return path.WallLeft
+}
@@ -0,0 +1,151 @@
+package toolpath
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/029614/gcode_lang/internal/data"
+	"github.com/029614/gcode_lang/internal/path"
+	"github.com/Anaxarchus/zero-gdscript/pkg/vector2"
+)
+
+// RestTolerance is the thinnest material left by the previous tool that is worth cleaning up.
+const RestTolerance = 0.002
+
+// getCleanupTool returns the spindle slot and tool that clean up after the operation's tool. The
+// operation's CleanupTool is used when it is loaded, otherwise the largest loaded straight bit
+// smaller than the operation's tool. Either must reach the cut depth. It returns 0 and nil if there
+// is none.
+func getCleanupTool(toolop *ToolpathOperation, router *data.Router, tools *data.ToolLibrary) (int, *data.Tool) {
+	if toolop.Operation.CleanupTool == "" || toolop.Tool == nil || router == nil {
+		return 0, nil
+	}
+	loaded := getSpindleTools(router, tools)
+	depth := toolop.Operation.CutHeight - toolop.Operation.CutDepth
+	if slot := router.FindSpindleSlot(toolop.Operation.CleanupTool); slot != 0 {
+		if tool, ok := loaded[slot]; ok && tool.CutDiameter < toolop.Tool.CutDiameter && tool.CutLength >= depth {
+			return slot, tool
+		}
+	}
+
+	slot := 0
+	best := 0.0
+	for idx := 1; idx <= data.SpindleSlotCount; idx++ {
+		tool, ok := loaded[idx]
+		if !ok || isDrill(tool) || tool.Shape != "straight" || tool.CutLength < depth {
+			continue
+		}
+		if tool.CutDiameter < toolop.Tool.CutDiameter && tool.CutDiameter > best {
+			best = tool.CutDiameter
+			slot = idx
+		}
+	}
+	if slot == 0 {
+		return 0, nil
+	}
+	return slot, loaded[slot]
+}
+
+// getRestOperation returns an operation that cleans up after a pocket operation with its cleanup
+// tool, or nil if the operation names none. The error reports an operation that names one when no
+// smaller tool that reaches the cut depth is loaded.
+func getRestOperation(toolop *ToolpathOperation, router *data.Router, tools *data.ToolLibrary) (*ToolpathOperation, error) {
+	if toolop.Operation.Type != "POCKET" || toolop.Operation.CleanupTool == "" {
+		return nil, nil
+	}
+	slot, tool := getCleanupTool(toolop, router, tools)
+	if tool == nil {
+		return nil, fmt.Errorf("operation %s: no cleanup tool smaller than %s that reaches the cut depth is loaded",
+			toolop.Operation.Name, toolop.Tool.Name)
+	}
+	return &ToolpathOperation{
+		Operation: toolop.Operation,
+		Tool:      tool,
+		Slot:      slot,
+		Previous:  toolop.Tool,
+		Material:  toolop.Material,
+		Z:         toolop.Z,
+		Parts:     toolop.Parts,
+		Instance:  toolop.Instance,
+	}, nil
+}
+
+// restLines returns the pieces of the cleanup tool's contours that cut material the previous tool
+// couldn't reach, deepest into the corners first. The contours step in from the walls until they
+// no longer find material, so thick corners are cleared as well as traced.
+func restLines(region pocketRegion, radius, previousRadius, step float64) [][]vector2.Vector2 {
+	// a cleanup tool centred in reached is wholly inside the area the previous tool swept
+	cleared := path.OffsetRegion(region.boundary, region.islands, -previousRadius, true)
+	reached := path.OffsetLoops(cleared, previousRadius-radius+RestTolerance, true)
+
+	var levels [][][]vector2.Vector2
+	for delta := radius; ; delta += step {
+		var contours [][]vector2.Vector2
+		for _, loop := range path.OffsetRegion(region.boundary, region.islands, -delta, true) {
+			contours = append(contours, append(loop, loop[0]))
+		}
+		if len(contours) == 0 {
+			break
+		}
+
+		var pieces [][]vector2.Vector2
+		for _, piece := range joinLines(path.ClipLines(contours, reached, false)) {
+			if w := newChainWalker(piece, false); w != nil && w.length() > RestTolerance {
+				pieces = append(pieces, piece)
+			}
+		}
+		if len(pieces) == 0 {
+			break
+		}
+		levels = append(levels, pieces)
+	}
+
+	var lines [][]vector2.Vector2
+	for i := len(levels) - 1; i >= 0; i-- {
+		lines = append(lines, levels[i]...)
+	}
+	return lines
+}
+
+// toolpathRest cleans up a pocket region after the previous tool, cutting only where it left material.
+func toolpathRest(toolop *ToolpathOperation, region pocketRegion) {
+	radius := toolop.Tool.CutDiameter * 0.5
+	previousRadius := toolop.Previous.CutDiameter * 0.5
+	if previousRadius <= radius {
+		return
+	}
+	lines := restLines(region, radius, previousRadius, math.Min(getStepover(toolop), previousRadius-radius))
+
+	z := toolop.Operation.CutHeight
+	for _, pass := range getPasses(toolop) {
+		for _, line := range lines {
+			toolop.cutPocketRow(line, z, pass)
+		}
+		z = pass.Depth
+	}
+}
+
+// joinLines joins lines that end where another begins, such as the two halves of a corner that
+// clipping split at the start of its loop.
+func joinLines(lines [][]vector2.Vector2) [][]vector2.Vector2 {
+	var res [][]vector2.Vector2
+	for _, line := range lines {
+		joined := false
+		for i, other := range res {
+			if other[len(other)-1].IsEqualApprox(line[0]) {
+				res[i] = append(other, line[1:]...)
+				joined = true
+			} else if line[len(line)-1].IsEqualApprox(other[0]) {
+				res[i] = append(append([]vector2.Vector2{}, line...), other[1:]...)
+				joined = true
+			}
+			if joined {
+				break
+			}
+		}
+		if !joined {
+			res = append(res, line)
+		}
+	}
+	return res
+}
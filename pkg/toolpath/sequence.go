@@ -0,0 +1,346 @@
+package toolpath
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/029614/gcode_lang/internal/data"
+	nestparser "github.com/029614/gcode_lang/internal/parser/nest"
+	"github.com/Anaxarchus/zero-gdscript/pkg/vector2"
+)
+
+// SequencePolicy decides the order operations are cut in on a sheet.
+type SequencePolicy struct {
+	DrillFirst  bool // drill every hole before routing
+	InsideFirst bool // cut inner features and cutouts before part perimeters
+	SmallFirst  bool // cut part perimeters from the smallest part to the largest
+	GroupByTool bool // keep operations sharing a tool together, carrying the tool in the spindle over between groups
+	Optimize    bool // refine the nearest neighbour order of each operation with 2-opt
+}
+
+// DefaultSequencePolicy holds parts down for as long as possible and keeps travel and tool changes low.
+var DefaultSequencePolicy = SequencePolicy{
+	DrillFirst:  true,
+	InsideFirst: true,
+	SmallFirst:  true,
+	GroupByTool: true,
+	Optimize:    true,
+}
+
+// MaxOptimizePasses bounds the number of 2-opt sweeps made over an operation's instances.
+const MaxOptimizePasses = 8
+
+// Sequence groups, in the order they are cut.
+const (
+	sequenceDrill = iota
+	sequenceInside
+	sequencePerimeter
+	sequenceCount
+)
+
+// getSequenceGroup returns the group an instance is cut with. Perimeters are the closed through cuts
+// around parts; everything else that isn't drilled is an inner feature.
+func getSequenceGroup(toolop *ToolpathOperation, ins *nestparser.Operation, policy *SequencePolicy) int {
+	if toolop.Operation.Type == "DRILL" {
+		if policy.DrillFirst {
+			return sequenceDrill
+		}
+		return sequenceInside
+	}
+	if !policy.InsideFirst || toolop.Operation.Name != PartCutOperation {
+		return sequenceInside
+	}
+	if p := getPath(ins); p != nil && p.Closed && !isInsideChain(ins) {
+		return sequencePerimeter
+	}
+	return sequenceInside
+}
+
+// splitSequence splits the operations into the sequence groups, keeping their order.
+func splitSequence(tops []*ToolpathOperation, policy *SequencePolicy) [sequenceCount][]*ToolpathOperation {
+	var groups [sequenceCount][]*ToolpathOperation
+	for _, top := range tops {
+		var split [sequenceCount]*ToolpathOperation
+		for _, ins := range top.Instance {
+			g := getSequenceGroup(top, ins, policy)
+			if split[g] == nil {
+				part := *top
+				part.Instance = nil
+				split[g] = &part
+				groups[g] = append(groups[g], &part)
+			}
+			split[g].Instance = append(split[g].Instance, ins)
+		}
+	}
+	return groups
+}
+
+// sequenceSheet orders the operations of a sheet and the instances within each operation, starting
+// with spindle, the id of the tool in the spindle, or "" if it isn't known.
+func sequenceSheet(tops []*ToolpathOperation, policy *SequencePolicy, spindle string) []*ToolpathOperation {
+	groups := splitSequence(tops, policy)
+
+	var res []*ToolpathOperation
+	tool := spindle
+	pos := vector2.Zero()
+	for g, group := range groups {
+		if g == sequencePerimeter && policy.SmallFirst {
+			sort.SliceStable(group, func(i, j int) bool {
+				return smallestPart(group[i]) < smallestPart(group[j])
+			})
+		} else if policy.GroupByTool {
+			group = groupByTool(group, tool, nextTools(groups[g+1:]))
+		}
+
+		for _, top := range group {
+			if g == sequencePerimeter && policy.SmallFirst {
+				top.Instance = sequenceBySize(top.Instance, pos, policy.Optimize)
+			} else {
+				top.Instance = sequenceInstances(top.Instance, pos, policy.Optimize)
+			}
+			if n := len(top.Instance); n > 0 {
+				pos = instanceEnd(top.Instance[n-1])
+			}
+			if key := toolKey(top); key != "" {
+				tool = key
+			}
+			res = append(res, top)
+		}
+	}
+	return res
+}
+
+// toolKey identifies the tool of an operation, so operations sharing a tool can be told apart from
+// those that need a tool change, whether or not the tool is loaded. It is "" for an operation the
+// spindle doesn't run, the gang drill's hits and holes no drill was found for.
+func toolKey(toolop *ToolpathOperation) string {
+	if toolop.Tool == nil {
+		return ""
+	}
+	return toolop.Tool.ID
+}
+
+// nextTools returns the tools of the first of the groups that has any operations the spindle runs.
+func nextTools(groups [][]*ToolpathOperation) map[string]bool {
+	for _, group := range groups {
+		res := make(map[string]bool)
+		for _, top := range group {
+			if key := toolKey(top); key != "" {
+				res[key] = true
+			}
+		}
+		if len(res) > 0 {
+			return res
+		}
+	}
+	return nil
+}
+
+// groupByTool orders operations so that those sharing a tool run together, so each tool is changed
+// to once. It starts with the tool already in the spindle and ends with a tool the next group uses,
+// so the change between groups can be saved too, and otherwise keeps the order each tool first
+// appears in. Operations the spindle doesn't run stay where they are, so the tool in the spindle
+// carries across them.
+func groupByTool(tops []*ToolpathOperation, tool string, next map[string]bool) []*ToolpathOperation {
+	var tooled []*ToolpathOperation
+	for _, top := range tops {
+		if toolKey(top) != "" {
+			tooled = append(tooled, top)
+		}
+	}
+
+	order := map[string]int{tool: -1}
+	for i, top := range tooled {
+		if _, ok := order[toolKey(top)]; !ok {
+			order[toolKey(top)] = i
+		}
+	}
+	for _, top := range tooled {
+		if key := toolKey(top); key != tool && next[key] {
+			order[key] = len(tooled)
+			break
+		}
+	}
+	sort.SliceStable(tooled, func(i, j int) bool {
+		return order[toolKey(tooled[i])] < order[toolKey(tooled[j])]
+	})
+
+	res := make([]*ToolpathOperation, len(tops))
+	for i, top := range tops {
+		if toolKey(top) == "" {
+			res[i] = top
+			continue
+		}
+		res[i], tooled = tooled[0], tooled[1:]
+	}
+	return res
+}
+
+// ToolChanges returns the number of times the spindle swaps tools between the sheet's operations,
+// starting with spindle, the id of the tool in the spindle. The first tool is only counted as a
+// change when the tool it replaces is known, and operations the spindle doesn't run leave its tool
+// in place.
+func ToolChanges(sheet []*ToolpathOperation, spindle string) int {
+	changes := 0
+	tool := spindle
+	for _, top := range sheet {
+		key := toolKey(top)
+		if key == "" {
+			continue
+		}
+		if key != tool && tool != "" {
+			changes++
+		}
+		tool = key
+	}
+	return changes
+}
+
+// checkSpindleTools reports each tool of the operations that isn't loaded in any spindle slot of
+// the router.
+func checkSpindleTools(tops []*ToolpathOperation, router *data.Router) error {
+	if router == nil {
+		return nil
+	}
+	var errs []error
+	reported := make(map[string]bool)
+	for _, top := range tops {
+		if top.Tool == nil || top.Slot != 0 || reported[top.Tool.ID] || len(top.Instance) == 0 {
+			continue
+		}
+		errs = append(errs, fmt.Errorf("operation %s: tool %s is not loaded in any spindle slot", top.Operation.Name, top.Tool.Name))
+		reported[top.Tool.ID] = true
+	}
+	return errors.Join(errs...)
+}
+
+func smallestPart(toolop *ToolpathOperation) float64 {
+	smallest := -1.0
+	for _, ins := range toolop.Instance {
+		if ins.Part == nil {
+			continue
+		}
+		if a := partArea(ins.Part); smallest < 0 || a < smallest {
+			smallest = a
+		}
+	}
+	return smallest
+}
+
+// sequenceBySize orders instances from the smallest part to the largest, sequencing parts of the
+// same size by distance.
+func sequenceBySize(instances []*nestparser.Operation, pos vector2.Vector2, optimize bool) []*nestparser.Operation {
+	sorted := make([]*nestparser.Operation, len(instances))
+	copy(sorted, instances)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return instanceArea(sorted[i]) < instanceArea(sorted[j])
+	})
+
+	var res []*nestparser.Operation
+	for i := 0; i < len(sorted); {
+		j := i + 1
+		for j < len(sorted) && instanceArea(sorted[j]) == instanceArea(sorted[i]) {
+			j++
+		}
+		run := sequenceInstances(sorted[i:j], pos, optimize)
+		pos = instanceEnd(run[len(run)-1])
+		res = append(res, run...)
+		i = j
+	}
+	return res
+}
+
+func instanceArea(ins *nestparser.Operation) float64 {
+	if ins.Part == nil {
+		return 0
+	}
+	return partArea(ins.Part)
+}
+
+// sequenceInstances orders instances by nearest neighbour from pos, then refines the order with 2-opt.
+func sequenceInstances(instances []*nestparser.Operation, pos vector2.Vector2, optimize bool) []*nestparser.Operation {
+	remaining := make([]*nestparser.Operation, len(instances))
+	copy(remaining, instances)
+
+	start := pos
+	res := make([]*nestparser.Operation, 0, len(instances))
+	for len(remaining) > 0 {
+		best := 0
+		for i, ins := range remaining {
+			if pos.DistanceSquaredTo(instanceStart(ins)) < pos.DistanceSquaredTo(instanceStart(remaining[best])) {
+				best = i
+			}
+		}
+		res = append(res, remaining[best])
+		pos = instanceEnd(remaining[best])
+		remaining = append(remaining[:best], remaining[best+1:]...)
+	}
+
+	if optimize {
+		twoOpt(res, start)
+	}
+	return res
+}
+
+// twoOpt reverses runs of instances while doing so shortens the travel between them.
+func twoOpt(instances []*nestparser.Operation, start vector2.Vector2) {
+	for pass := 0; pass < MaxOptimizePasses; pass++ {
+		improved := false
+		for i := 0; i < len(instances)-1; i++ {
+			for j := i + 1; j < len(instances); j++ {
+				before := travel(instances, start, i, j)
+				reverse(instances, i, j)
+				if travel(instances, start, i, j) < before-1e-9 {
+					improved = true
+				} else {
+					reverse(instances, i, j)
+				}
+			}
+		}
+		if !improved {
+			return
+		}
+	}
+}
+
+// travel is the distance travelled from the instance before i to the instance after j.
+func travel(instances []*nestparser.Operation, start vector2.Vector2, i, j int) float64 {
+	pos := start
+	if i > 0 {
+		pos = instanceEnd(instances[i-1])
+	}
+	var d float64
+	for k := i; k <= j+1 && k < len(instances); k++ {
+		d += pos.DistanceTo(instanceStart(instances[k]))
+		pos = instanceEnd(instances[k])
+	}
+	return d
+}
+
+func reverse(instances []*nestparser.Operation, i, j int) {
+	for ; i < j; i, j = i+1, j-1 {
+		instances[i], instances[j] = instances[j], instances[i]
+	}
+}
+
+// instanceStart returns where cutting an instance begins, before compensation.
+func instanceStart(ins *nestparser.Operation) vector2.Vector2 {
+	switch g := ins.Geometry.(type) {
+	case nestparser.ChainGeometry:
+		if len(g.Points) > 0 {
+			return g.Points[0].Vector2
+		}
+	case nestparser.ArcGeometry:
+		return g.Position.Vector2
+	}
+	return vector2.Zero()
+}
+
+// instanceEnd returns where cutting an instance ends, before compensation.
+func instanceEnd(ins *nestparser.Operation) vector2.Vector2 {
+	if g, ok := ins.Geometry.(nestparser.ChainGeometry); ok && g.Closed != 1 && len(g.Points) > 0 {
+		return g.Points[len(g.Points)-1].Vector2
+	}
+	return instanceStart(ins)
+}
@@ -0,0 +1,177 @@
+package toolpath
+
+import (
+	"testing"
+
+	"github.com/029614/gcode_lang/internal/data"
+	nestparser "github.com/029614/gcode_lang/internal/parser/nest"
+	"github.com/Anaxarchus/zero-gdscript/pkg/vector2"
+)
+
+// sequenceSheetOperations returns the operations of a sheet of three parts of different sizes, each
+// with a cutout and a hole, and a groove in the largest, in the order they are nested.
+func sequenceSheetOperations() []*ToolpathOperation {
+	var parts []*nestparser.Part
+	for i, size := range []vector2.Vector2{vector2.New(20, 10), vector2.New(4, 4), vector2.New(10, 6)} {
+		origin := vector2.New(float64(i)*25, 0)
+		ops := []nestparser.Operation{rectChain(PartCutOperation, vector2.New(1, 1), vector2.New(1, 1))}
+		if i == 0 {
+			ops = append(ops, chainOperation("Groove", false, vector2.New(5, 5), vector2.New(15, 5)))
+		}
+		part := testPart(string(rune('a'+i)), origin, size, ops...)
+		part.Geometry.Arcs = []nestparser.Operation{{
+			Operation: "Drill",
+			Geometry:  nestparser.ArcGeometry{Radius: 0.125, Position: nestparser.Point{Vector2: part.Place(vector2.New(3, 3))}},
+			Part:      part,
+		}}
+		parts = append(parts, part)
+	}
+
+	groove := testCut()
+	groove.Name, groove.Tool = "Groove", "eighth"
+	drill := &ToolpathOperation{
+		Operation: &data.Operation{Name: "Drill", Type: "DRILL", Tool: "drill"},
+		Tool:      &data.Tool{ID: "drill", CutDiameter: 0.25, Shape: "drill"},
+	}
+	for _, part := range parts {
+		drill.Instance = append(drill.Instance, &part.Geometry.Arcs[0])
+	}
+	return []*ToolpathOperation{
+		testOperation(testCut(), testTool(), parts...),
+		testOperation(groove, &data.Tool{ID: "eighth", CutDiameter: 0.125}, parts...),
+		drill,
+	}
+}
+
+func TestSequenceSheet(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy SequencePolicy
+	}{
+		{"default", DefaultSequencePolicy},
+		{"drilled with the inside", SequencePolicy{InsideFirst: true, SmallFirst: true, GroupByTool: true}},
+		{"perimeters with the rest", SequencePolicy{DrillFirst: true, GroupByTool: true}},
+		{"in the nested order", SequencePolicy{}},
+		{"optimized", SequencePolicy{DrillFirst: true, InsideFirst: true, Optimize: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tops := sequenceSheetOperations()
+			count := 0
+			for _, top := range tops {
+				count += len(top.Instance)
+			}
+
+			sequenced := sequenceSheet(tops, &tt.policy, "")
+			seen := make(map[*nestparser.Operation]bool)
+			group, area := 0, 0.0
+			tools := make(map[string]int) // the group each tool was last used in
+			last := ""
+			for _, top := range sequenced {
+				for _, ins := range top.Instance {
+					if seen[ins] {
+						t.Errorf("%s instance cut twice", top.Operation.Name)
+					}
+					seen[ins] = true
+
+					g := getSequenceGroup(top, ins, &tt.policy)
+					if g < group {
+						t.Errorf("%s instance of group %d cut after group %d", top.Operation.Name, g, group)
+					}
+					if g > group {
+						group, area = g, 0
+					}
+					if g == sequencePerimeter && tt.policy.SmallFirst {
+						if instanceArea(ins) < area {
+							t.Errorf("part of %v cut after a part of %v", instanceArea(ins), area)
+						}
+						area = instanceArea(ins)
+					}
+				}
+				// operations sharing a tool run together within a group, across any without one
+				if key := toolKey(top); key != "" {
+					if g, ok := tools[key]; tt.policy.GroupByTool && ok && g == group && key != last {
+						t.Errorf("tool %s comes back within group %d", key, group)
+					}
+					tools[key], last = group, key
+				}
+			}
+			if len(seen) != count {
+				t.Errorf("%d instances cut, want %d", len(seen), count)
+			}
+			if tt.policy.DrillFirst && sequenced[0].Operation.Type != "DRILL" {
+				t.Errorf("starts with %s, want the holes drilled first", sequenced[0].Operation.Name)
+			}
+		})
+	}
+}
+
+func TestGroupByTool(t *testing.T) {
+	tests := []struct {
+		name    string
+		tools   []string // "" for an operation without a tool
+		spindle string
+		next    map[string]bool
+		want    []string
+	}{
+		{"nested order", []string{"a", "b", "a", "c", "b"}, "", nil, []string{"a", "a", "b", "b", "c"}},
+		{"loaded first", []string{"a", "b", "a", "c", "b"}, "b", nil, []string{"b", "b", "a", "a", "c"}},
+		{"ready for the next group", []string{"a", "b", "a", "c", "b"}, "", map[string]bool{"a": true}, []string{"b", "b", "c", "a", "a"}},
+		{"loaded and ready", []string{"a", "b", "c"}, "a", map[string]bool{"b": true}, []string{"a", "c", "b"}},
+		{"gang hits stay in place", []string{"", "a", "", "b", "a"}, "", nil, []string{"", "a", "", "a", "b"}},
+		{"loaded across gang hits", []string{"", "a", "b"}, "b", nil, []string{"", "b", "a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := groupByTool(toolOperations(tt.tools), tt.spindle, tt.next)
+			for i := range got {
+				if toolKey(got[i]) != tt.want[i] {
+					var keys []string
+					for _, top := range got {
+						keys = append(keys, toolKey(top))
+					}
+					t.Fatalf("grouped %v, want %v", keys, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestToolChanges(t *testing.T) {
+	tests := []struct {
+		name    string
+		tools   []string // "" for an operation without a tool
+		spindle string
+		changes int
+	}{
+		{"nothing", nil, "a", 0},
+		{"one tool, unknown spindle", []string{"a", "a"}, "", 0},
+		{"one tool, already loaded", []string{"a", "a"}, "a", 0},
+		{"one tool, loaded first", []string{"a", "a"}, "b", 1},
+		{"back and forth", []string{"a", "b", "a"}, "", 2},
+		{"back and forth from the spindle", []string{"a", "b", "a"}, "a", 2},
+		{"gang hit between a tool's operations", []string{"a", "", "a"}, "a", 0},
+		{"gang hits first", []string{"", "", "a", "b"}, "a", 1},
+		{"gang hits first, unknown spindle", []string{"", "a", "b"}, "", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ToolChanges(toolOperations(tt.tools), tt.spindle); got != tt.changes {
+				t.Errorf("ToolChanges = %d, want %d", got, tt.changes)
+			}
+		})
+	}
+}
+
+// toolOperations returns an operation with each of the tools, without a tool for "".
+func toolOperations(tools []string) []*ToolpathOperation {
+	var tops []*ToolpathOperation
+	for _, tool := range tools {
+		top := &ToolpathOperation{Operation: &data.Operation{Name: tool}}
+		if tool != "" {
+			top.Tool = &data.Tool{ID: tool}
+		}
+		tops = append(tops, top)
+	}
+	return tops
+}
@@ -0,0 +1,86 @@
+package toolpath
+
+import (
+	"math"
+
+	"github.com/029614/gcode_lang/internal/data"
+	nestparser "github.com/029614/gcode_lang/internal/parser/nest"
+	"github.com/Anaxarchus/zero-gdscript/pkg/vector2"
+)
+
+// getPartFeedFactor returns the fraction of the feed rate the part is cut at.
+func getPartFeedFactor(red *data.FeedReduction, part *nestparser.Part) float64 {
+	if part == nil {
+		return 1
+	}
+	switch getCategory(getPartRect(part)) {
+	case PartCategorySmall:
+		if red.Small > 0 {
+			return red.Small
+		}
+	case PartCategoryTiny:
+		if red.Tiny > 0 {
+			return red.Tiny
+		}
+	}
+	return 1
+}
+
+// getVertexFeedFactor returns the fraction of the feed rate the tool passes through b at, travelling
+// from a to c. Turns of at least CornerAngle are corners, slowed by their angle, and gentler turns
+// follow arcs, slowed by their radius.
+func getVertexFeedFactor(red *data.FeedReduction, a, b, c vector2.Vector2) float64 {
+	ab, bc := b.Sub(a), c.Sub(b)
+	if ab.LengthSquared() < 1e-12 || bc.LengthSquared() < 1e-12 {
+		return 1
+	}
+	turn := math.Abs(ab.AngleTo(bc))
+	if turn >= CornerAngle {
+		return red.Corner.At(turn * 180.0 / math.Pi)
+	}
+	cross := math.Abs(ab.Cross(bc))
+	if cross < 1e-12 {
+		return 1
+	}
+	// the radius of the circle through the three points
+	radius := ab.Length() * bc.Length() * c.DistanceTo(a) / (2 * cross)
+	return red.Radius.At(radius)
+}
+
+// reduceFeeds slows the cutting moves of the toolpath from start on, which cut the part, on tight arcs,
+// at sharp corners and on small parts, as far as the operation's FeedReduction has them slowed. Each
+// move runs at the slowest of the factors at its ends.
+func (toolop *ToolpathOperation) reduceFeeds(start int, part *nestparser.Part) {
+	red := toolop.Operation.FeedReduction
+	if red == nil {
+		return
+	}
+	partFactor := getPartFeedFactor(red, part)
+	tp := toolop.Toolpath[start:]
+
+	factors := make([]float64, len(tp))
+	for k := range tp {
+		factors[k] = 1
+		if k == 0 || k+1 >= len(tp) || tp[k][3] == 0 || tp[k+1][3] == 0 {
+			continue
+		}
+		factors[k] = getVertexFeedFactor(red,
+			vector2.New(tp[k-1][0], tp[k-1][1]),
+			vector2.New(tp[k][0], tp[k][1]),
+			vector2.New(tp[k+1][0], tp[k+1][1]),
+		)
+	}
+
+	for k := range tp {
+		if tp[k][3] == 0 {
+			continue
+		}
+		f := partFactor * factors[k]
+		if k > 0 {
+			f = math.Min(f, partFactor*factors[k-1])
+		}
+		if f < 1 {
+			tp[k][3] = math.Max(math.Round(tp[k][3]*f), 1)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package toolpath
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/029614/gcode_lang/internal/data"
+	nestparser "github.com/029614/gcode_lang/internal/parser/nest"
+	"github.com/029614/gcode_lang/internal/path"
+	"github.com/Anaxarchus/zero-gdscript/pkg/geometry2d"
+	"github.com/Anaxarchus/zero-gdscript/pkg/vector2"
+)
+
+// tabLineTolerance is how far the ends of a chord may be from a line of the path and still be on it.
+const tabLineTolerance = 1e-6
+
+// DefaultTabRampAngle is the angle, in degrees, the tool climbs over a tab at when the operation has no ramp.
+const DefaultTabRampAngle = 45.0
+
+// PlacedTab is a holding tab as it was cut, so the operator knows where to break the part free.
+type PlacedTab struct {
+	Sheet    int             `json:"sheet"`
+	Part     string          `json:"part"`
+	Position vector2.Vector2 `json:"position"`
+	Width    float64         `json:"width"`
+	Height   float64         `json:"height"`
+}
+
+// tabSpan is a tab measured along the chain being cut.
+type tabSpan struct {
+	center float64
+	half   float64 // half the tab width
+	top    float64 // Z of the top of the tab
+	slope  float64 // rise per unit of travel while climbing over the tab
+}
+
+// getTabs returns the tabs of a PartCut instance along w, the walker over p. The part's own tabs take
+// precedence over the operation's rules for the part category. The placed tabs are recorded on the
+// operation.
+func (toolop *ToolpathOperation) getTabs(ins *nestparser.Operation, w *chainWalker, p *path.Path) []tabSpan {
+	if toolop.Operation.Name != PartCutOperation || ins.Part == nil {
+		return nil
+	}
+
+	rampAngle := toolop.Operation.Ramp
+	if rampAngle <= 0 {
+		rampAngle = DefaultTabRampAngle
+	}
+	slope := math.Tan(rampAngle * math.Pi / 180.0)
+
+	var tabs []nestparser.Tab
+	var centers []float64
+	if len(ins.Part.Tabs) > 0 {
+		tabs = ins.Part.Tabs
+		for _, tab := range tabs {
+			centers = append(centers, w.project(tab.Position))
+		}
+	} else {
+		rule, ok := toolop.Operation.Tabs[getCategory(getPartRect(ins.Part)).String()]
+		if !ok || rule.Count <= 0 || rule.Width <= 0 || rule.Height <= 0 {
+			return nil
+		}
+		margin := rule.Height / slope
+		if toolop.Tool != nil {
+			margin += toolop.Tool.CutDiameter * 0.5
+		}
+		centers = placeTabs(w, getLines(p), rule, margin)
+		for range centers {
+			tabs = append(tabs, nestparser.Tab{Width: rule.Width, Height: rule.Height})
+		}
+	}
+
+	spans := make([]tabSpan, 0, len(centers))
+	for i, c := range centers {
+		spans = append(spans, tabSpan{
+			center: c,
+			half:   tabs[i].Width * 0.5,
+			top:    toolop.Operation.CutDepth + tabs[i].Height,
+			slope:  slope,
+		})
+		toolop.Tabs = append(toolop.Tabs, PlacedTab{
+			Part:     ins.Part.ID,
+			Position: w.positionAt(c),
+			Width:    tabs[i].Width,
+			Height:   tabs[i].Height,
+		})
+	}
+	return spans
+}
+
+// placeTabs spreads rule.Count tabs evenly around a closed chain, keeping each one on one of its
+// straight lines, at least margin away from its corners. Tabs are kept off arcs, whose chords are
+// long enough to hold one on large radii.
+func placeTabs(w *chainWalker, lines []path.Segment, rule data.TabRule, margin float64) []float64 {
+	type straight struct{ from, to float64 }
+	var straights []straight
+	var d float64
+	for i := 0; i < w.segmentCount(); i++ {
+		l := w.segmentLength(i)
+		if a, b := w.segment(i); l >= rule.Width+2*margin && onLines(a, b, lines) {
+			straights = append(straights, straight{
+				from: d + margin + rule.Width*0.5,
+				to:   d + l - margin - rule.Width*0.5,
+			})
+		}
+		d += l
+	}
+	if len(straights) == 0 {
+		return nil
+	}
+
+	var centers []float64
+	for k := 0; k < rule.Count; k++ {
+		ideal := w.length() * (float64(k) + 0.5) / float64(rule.Count)
+
+		best := math.Inf(1)
+		center := 0.0
+		for _, s := range straights {
+			c := math.Max(s.from, math.Min(s.to, ideal))
+			if dd := chainDistance(w, c, ideal); dd < best {
+				best = dd
+				center = c
+			}
+		}
+
+		crowded := false
+		for _, c := range centers {
+			if chainDistance(w, c, center) < rule.Width*2 {
+				crowded = true
+				break
+			}
+		}
+		if !crowded {
+			centers = append(centers, center)
+		}
+	}
+	return centers
+}
+
+// getLines returns the straight lines of the path. A path without exact segments, as clipper leaves
+// an offset it had to make, is taken as lines between its points.
+func getLines(p *path.Path) []path.Segment {
+	segs := p.Segments
+	if len(segs) == 0 {
+		segs = path.LineSegments(p.Points)
+	}
+	var lines []path.Segment
+	for _, seg := range segs {
+		if seg.Kind == path.SegmentLine {
+			lines = append(lines, seg)
+		}
+	}
+	return lines
+}
+
+// onLines reports whether the chord from a to b lies along one of the lines.
+func onLines(a, b vector2.Vector2, lines []path.Segment) bool {
+	for _, line := range lines {
+		seg := [2]vector2.Vector2{line.Start, line.End}
+		if a.DistanceTo(geometry2d.GetClosestPointToSegment(a, seg)) < tabLineTolerance &&
+			b.DistanceTo(geometry2d.GetClosestPointToSegment(b, seg)) < tabLineTolerance {
+			return true
+		}
+	}
+	return false
+}
+
+// chainDistance is the distance between two positions along a closed chain, going either way round.
+func chainDistance(w *chainWalker, a, b float64) float64 {
+	d := math.Mod(math.Abs(a-b), w.length())
+	return math.Min(d, w.length()-d)
+}
+
+// tabHeight returns the lowest Z the tool may reach at distance s along the chain.
+func tabHeight(w *chainWalker, tabs []tabSpan, s float64) float64 {
+	z := math.Inf(-1)
+	for _, t := range tabs {
+		over := math.Max(0, chainDistance(w, s, t.center)-t.half)
+		z = math.Max(z, t.top-over*t.slope)
+	}
+	return z
+}
+
+// tabBreaks returns the distances along the chain where cutting at depth meets the tabs.
+func tabBreaks(tabs []tabSpan, depth float64) []float64 {
+	var breaks []float64
+	for _, t := range tabs {
+		if depth >= t.top {
+			continue
+		}
+		climb := t.half + (t.top-depth)/t.slope
+		breaks = append(breaks, t.center-climb, t.center-t.half, t.center+t.half, t.center+climb)
+	}
+	return breaks
+}
+
+// addProfile walks distance along a closed chain, stopping at every break, and cuts to the Z
+// given by zAt for the distance travelled, lifted over any tabs.
+func (toolop *ToolpathOperation) addProfile(w *chainWalker, distance, feed float64, tabs []tabSpan, breaks []float64, zAt func(travel float64) float64) {
+	var travel float64
+	for distance-travel > 1e-9 {
+		step := distance - travel
+		for _, b := range breaks {
+			ahead := math.Mod(math.Mod(b-w.dist, w.length())+w.length(), w.length())
+			if ahead > 1e-9 && ahead < step {
+				step = ahead
+			}
+		}
+
+		from := w.pos
+		s := w.dist
+		for _, pt := range w.walk(step) {
+			d := from.DistanceTo(pt)
+			travel += d
+			s += d
+			from = pt
+			z := zAt(travel)
+			if len(tabs) > 0 {
+				z = math.Max(z, tabHeight(w, tabs, s))
+			}
+			toolop.Toolpath = append(toolop.Toolpath, ToolpathPoint{pt.X, pt.Y, z, feed})
+		}
+	}
+}
+
+// Tabs returns every holding tab placed in the solution, with the sheet it is on.
+func (sol *ToolpathSolution) Tabs() []PlacedTab {
+	var tabs []PlacedTab
+	for _, sheet := range *sol {
+		if sheet == nil {
+			continue
+		}
+		for _, top := range sheet.Operations {
+			for _, tab := range top.Tabs {
+				tab.Sheet = sheet.Number
+				tabs = append(tabs, tab)
+			}
+		}
+	}
+	return tabs
+}
+
+// SaveTabs writes the holding tabs of the solution to a JSON file, for the operator to find the
+// tabs to break parts free at.
+func (sol *ToolpathSolution) SaveTabs(filepath string) error {
+	file, err := os.Create(filepath)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %v", filepath, err)
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(sol.Tabs()); err != nil {
+		return fmt.Errorf("failed to write tabs to file %s: %v", filepath, err)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package toolpath
+
+import (
+	"math"
+	"testing"
+
+	"github.com/029614/gcode_lang/internal/data"
+	nestparser "github.com/029614/gcode_lang/internal/parser/nest"
+	"github.com/029614/gcode_lang/internal/path"
+	"github.com/Anaxarchus/zero-gdscript/pkg/vector2"
+)
+
+func TestToolpathChainTabs(t *testing.T) {
+	size := vector2.New(20, 10)
+	category := getCategory(getPartRect(&nestparser.Part{Size: size})).String()
+	tests := []struct {
+		name  string
+		rule  data.TabRule
+		count int
+	}{
+		{"none", data.TabRule{}, 0},
+		{"two", data.TabRule{Count: 2, Width: 0.5, Height: 0.1}, 2},
+		{"four", data.TabRule{Count: 4, Width: 0.375, Height: 0.2}, 4},
+		{"too wide for the edges", data.TabRule{Count: 2, Width: 30, Height: 0.1}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := testCut()
+			op.Tabs = map[string]data.TabRule{category: tt.rule}
+			part := testPart("part", vector2.New(1, 1), size)
+			toolop := testOperation(op, testTool(), part)
+			if err := toolpathChain(toolop); err != nil {
+				t.Fatal(err)
+			}
+			checkToolpath(t, toolop)
+
+			if len(toolop.Tabs) != tt.count {
+				t.Fatalf("%d tabs, want %d", len(toolop.Tabs), tt.count)
+			}
+			for _, tab := range toolop.Tabs {
+				if tab.Part != part.ID || tab.Width != tt.rule.Width || tab.Height != tt.rule.Height {
+					t.Errorf("tab %+v, want %+v on %s", tab, tt.rule, part.ID)
+				}
+				// the tool passes over the whole width of the tab at no lower than its top
+				top := op.CutDepth + tab.Height
+				over := 0
+				for _, pt := range toolop.Toolpath {
+					if pt[3] != 0 && vector2.New(pt[0], pt[1]).DistanceTo(tab.Position) <= tab.Width*0.5+testTolerance {
+						over++
+						if pt[2] < top-testTolerance {
+							t.Errorf("point %v cuts into the tab at %v, below its top %v", pt, tab.Position, top)
+						}
+					}
+				}
+				if over == 0 {
+					t.Errorf("no cut passes over the tab at %v", tab.Position)
+				}
+			}
+		})
+	}
+}
+
+func TestToolpathChainTabsOffArcs(t *testing.T) {
+	size := vector2.New(20, 10)
+	rule := data.TabRule{Count: 4, Width: 0.375, Height: 0.1}
+	tests := []struct {
+		name  string
+		bulge float64 // of the part's bottom edge
+	}{
+		{"bulging out", 0.05},
+		{"bulging in", -0.05},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := testCut()
+			op.Tabs = map[string]data.TabRule{getCategory(getPartRect(&nestparser.Part{Size: size})).String(): rule}
+			part := testPart("part", vector2.New(1, 1), size)
+			// a shallow arc of a radius of about 100, whose chords at ChainTolerance are long enough
+			// to hold a tab
+			chain := part.Geometry.Chains[0].Geometry.(nestparser.ChainGeometry)
+			chain.Points[0].Bulge = tt.bulge
+			arc := path.BulgeSegment(chain.Points[0].Vector2, chain.Points[1].Vector2, tt.bulge)
+			toolop := testOperation(op, testTool(), part)
+			if err := toolpathChain(toolop); err != nil {
+				t.Fatal(err)
+			}
+			checkToolpath(t, toolop)
+
+			if len(toolop.Tabs) == 0 {
+				t.Fatal("no tabs placed on the straight edges")
+			}
+			for _, tab := range toolop.Tabs {
+				// the tool runs round the arc a tool radius off it
+				off := math.Abs(tab.Position.DistanceTo(arc.Center) - arc.Radius())
+				if math.Abs(off-toolop.Tool.CutDiameter*0.5) < 1e-3 && tab.Position.X > 1 && tab.Position.X < 21 {
+					t.Errorf("tab at %v is on the arc", tab.Position)
+				}
+			}
+		})
+	}
+}
@@ -1,14 +1,29 @@
 package toolpath
 
 import (
+	"fmt"
 	"math"
 
 	"github.com/029614/gcode_lang/internal/data"
 	nestparser "github.com/029614/gcode_lang/internal/parser/nest"
 	"github.com/029614/gcode_lang/internal/path"
+	"github.com/029614/gcode_lang/internal/patterns"
 	"github.com/Anaxarchus/zero-gdscript/pkg/vector2"
 )
 
+// ChainTolerance is the furthest the points toolpaths follow may stray from the arcs of a chain.
+const ChainTolerance = 0.001
+
+// arcSteps returns the number of lines an arc of the radius and sweep is cut in, so none strays
+// more than ChainTolerance from the arc.
+func arcSteps(radius, sweep float64) int {
+	step := math.Pi
+	if radius > ChainTolerance {
+		step = 2 * math.Acos(1-ChainTolerance/radius)
+	}
+	return max(int(math.Ceil(math.Abs(sweep)/step)), 1)
+}
+
 type ArcPoint struct {
 	Position vector2.Vector2
 	Radius   float64
@@ -16,67 +31,266 @@ type ArcPoint struct {
 	End      float64
 }
 
+// ToolpathPoint is a single move of the toolpath: X, Y, Z and the feed rate used to reach it.
+// A feed rate of 0 is a rapid move.
 type ToolpathPoint [4]float64
 
 type ToolpathOperation struct {
 	Operation *data.Operation
+	Tool      *data.Tool
+	Slot      int        // the spindle slot holding Tool, or 0 if it isn't loaded
+	Previous  *data.Tool // the tool that cleared the operation before Tool, when Tool is cleaning up after it
+	Material  *data.Material
+	Z         ZReference         // resolves the operation's heights and depths, and converts them for the machine
+	Parts     []*nestparser.Part // every part on the sheet, which lead moves keep clear of
 	Instance  []*nestparser.Operation
 	Toolpath  []ToolpathPoint
+	Tabs      []PlacedTab
+	Freed     []FreedRegion      // the regions the operation cuts loose, which rapids keep clear of
+	Split     *PassSplit         // the share of the cut's passes taken, when it is shared between tools
+	Gang      []patterns.GangHit // the hits of the gang drill, when the operation drills with it
+	Spans     []PartSpan         // the stretches of Toolpath cutting each instance, in order
+}
+
+// PartSpan is the stretch of an operation's toolpath, from index From up to To, that cuts one
+// instance of a part.
+type PartSpan struct {
+	Part     *nestparser.Part
+	From, To int
 }
 
 type Polygon []vector2.Vector2
 
-func toolpathClosedChain(toolop *ToolpathOperation) error {
-	// calculate offset
-	return nil
-}
+func toolpathClosedChain(toolop *ToolpathOperation, ins *nestparser.Operation, p *path.Path, inside bool) error {
+	w := newChainWalker(p.Points, true)
+	if w == nil {
+		return fmt.Errorf("operation %s: closed chain has no length after compensation", toolop.Operation.Name)
+	}
+	w = w.startingAt(toolop.getStartDistance(ins, w))
+	tabs := toolop.getTabs(ins, w, p)
+	leadIn, leadOut := toolop.getLeads(ins, w, inside)
+	overlap := math.Max(toolop.Operation.Overlap, 0)
 
-func toolpathChain(toolop *ToolpathOperation, closed bool) error {
-	offset := getCompensation(toolop)
-	paths := getPaths(toolop)
-	rampDist := getRampIn(toolop)
-	for _, p := range paths {
+	// passes after a lead out come back down to the chain, which is cut down to the previous pass
+	retracted := true
+	z := getPassStart(toolop)
+	for _, pass := range getPasses(toolop) {
+		breaks := tabBreaks(tabs, pass.Depth)
 
-		// get ramp
-		path := p.Offset(offset, true)
-		if rampDist > 0 {
-			if closed {
-				// ramp in
+		if leadIn == nil && retracted {
+			toolop.addEntry(w.pos)
+			if z < toolop.Operation.CutHeight {
+				toolop.addPlunge(w.pos, z)
+			}
+		}
+		if leadIn != nil {
+			// every pass comes in off the part, so the lead is where the tool goes down
+			toolop.addEntry(leadIn[0])
+			if toolop.Operation.LeadIn == LeadRamp {
+				if z < toolop.Operation.CutHeight {
+					toolop.addPlunge(leadIn[0], z)
+				}
+				toolop.addRamp(leadIn[0], leadIn[1:], polylineLength(leadIn), z, pass)
 			} else {
-				// ramp in
+				toolop.addPlunge(leadIn[0], pass.Depth)
+				toolop.addCut(pass, leadIn[1:]...)
 			}
+		} else if rampDist := getRampIn(toolop, z, pass.Depth); rampDist > 0 {
+			// ramp down from the previous level, then one full loop at depth which also cleans up the ramp
+			from := z
+			toolop.addProfile(w, rampDist, pass.Feed, tabs, breaks, func(travel float64) float64 {
+				return from - (from-pass.Depth)*math.Min(travel/rampDist, 1.0)
+			})
+		} else {
+			toolop.addPlunge(w.pos, math.Max(pass.Depth, tabHeight(w, tabs, w.dist)))
 		}
+		toolop.addProfile(w, w.length()+overlap, pass.Feed, tabs, breaks, func(float64) float64 {
+			return pass.Depth
+		})
 
-		// get rest of path
-
+		retracted = leadIn != nil || leadOut != nil
+		if retracted {
+			toolop.addLeadOut(leadOut, pass)
+			// the next pass starts over from the start of the chain
+			w.reset()
+		}
+		z = pass.Depth
+	}
+	if leadIn == nil && leadOut == nil {
+		toolop.addRetract()
 	}
 	return nil
 }
 
-func toolpathPocket(toolop *ToolpathOperation) error {
-	return nil
+// polylineLength returns the length of the lines through the points.
+func polylineLength(points []vector2.Vector2) float64 {
+	var l float64
+	for i := 1; i < len(points); i++ {
+		l += points[i-1].DistanceTo(points[i])
+	}
+	return l
 }
 
-func toolpathArc(toolop *ToolpathOperation) error {
+// addLeadOut cuts the lead out at the pass depth, rising to CutHeight along ramps, then retracts.
+func (toolop *ToolpathOperation) addLeadOut(lead []vector2.Vector2, pass Pass) {
+	if len(lead) > 1 {
+		if toolop.Operation.LeadOut == LeadRamp {
+			end := lead[len(lead)-1]
+			toolop.Toolpath = append(toolop.Toolpath, ToolpathPoint{end.X, end.Y, toolop.Operation.CutHeight, pass.Feed})
+		} else {
+			toolop.addCut(pass, lead[1:]...)
+		}
+	}
+	toolop.addRetract()
+}
+
+func toolpathOpenChain(toolop *ToolpathOperation, p *path.Path) error {
+	w := newChainWalker(p.Points, false)
+	if w == nil {
+		return fmt.Errorf("operation %s: open chain has no length", toolop.Operation.Name)
+	}
+
+	start := w.pos
+	z := getPassStart(toolop)
+	for _, pass := range getPasses(toolop) {
+		toolop.addEntry(start)
+		if z < toolop.Operation.CutHeight {
+			// the slot is already cleared down to the previous pass
+			toolop.addPlunge(start, z)
+		}
+
+		if rampDist := getRampIn(toolop, z, pass.Depth); rampDist > 0 {
+			// ramp back and forth along the chain, then return to its start at depth
+			toolop.addRamp(start, w.walk(rampDist), rampDist, z, pass)
+			toolop.addCut(pass, w.toStart()...)
+		} else {
+			toolop.addPlunge(start, pass.Depth)
+		}
+
+		toolop.addCut(pass, w.points[1:]...)
+		toolop.addRetract()
+		w.toStart()
+		z = pass.Depth
+	}
 	return nil
 }
 
-func sortPaths(paths []*path.Path) []*path.Path {
-	// sort paths by nearest neighbor
+func toolpathChain(toolop *ToolpathOperation) error {
+	for _, ins := range toolop.Instance {
+		p := getPath(ins)
+		if p == nil {
+			continue
+		}
+		start := len(toolop.Toolpath)
+		if toolop.Operation.Strategy == PocketStrategyAdaptive && toolop.Tool != nil && toolpathAdaptiveSlot(toolop, ins, p) {
+			toolop.reduceFeeds(start, ins.Part)
+			toolop.Spans = append(toolop.Spans, PartSpan{Part: ins.Part, From: start, To: len(toolop.Toolpath)})
+			continue
+		}
+		var err error
+		if p.Closed {
+			inside := isInsideChain(ins)
+			offset := getClosedCompensation(toolop, inside)
+			tabs := len(toolop.Tabs)
+			if allowance := getFinishAllowance(toolop, offset); allowance != 0 {
+				// the roughing passes stay the allowance off the wall, then one full depth pass takes it off
+				err = toolpathClosedOffset(toolop, ins, p, offset+allowance, inside)
+				if err == nil {
+					fin := getFinishOperation(toolop)
+					err = toolpathClosedOffset(fin, finishInstance(ins, toolop.Tabs[tabs:]), p, offset, inside)
+					toolop.Toolpath = append(toolop.Toolpath, fin.Toolpath...)
+					toolop.Tabs = append(toolop.Tabs[:tabs], fin.Tabs...)
+				}
+			} else {
+				err = toolpathClosedOffset(toolop, ins, p, offset, inside)
+			}
+			if err == nil && frees(toolop, tabs) {
+				toolop.Freed = append(toolop.Freed, FreedRegion{Rect: chainRect(p), From: len(toolop.Toolpath)})
+			}
+		} else {
+			op, offset := orientOpen(toolop, p)
+			if allowance := getFinishAllowance(toolop, offset); allowance != 0 {
+				err = toolpathOpenOffset(toolop, op, offset+allowance)
+				if err == nil {
+					fin := getFinishOperation(toolop)
+					err = toolpathOpenOffset(fin, op, offset)
+					toolop.Toolpath = append(toolop.Toolpath, fin.Toolpath...)
+				}
+			} else {
+				err = toolpathOpenOffset(toolop, op, offset)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		toolop.reduceFeeds(start, ins.Part)
+		toolop.Spans = append(toolop.Spans, PartSpan{Part: ins.Part, From: start, To: len(toolop.Toolpath)})
+	}
 	return nil
 }
 
+// toolpathClosedOffset cuts a closed chain compensated by offset, with its corners relieved.
+func toolpathClosedOffset(toolop *ToolpathOperation, ins *nestparser.Operation, p *path.Path, offset float64, inside bool) error {
+	op := orientClosed(toolop, p.Offset(offset, true), inside)
+	// outward offsets leave the wall inside the loop, which is on the right of clockwise loops
+	op = relieveCorners(toolop, op, getWall(offset, (offset > 0) == (path.Area(op.Points) < 0)))
+	return toolpathClosedChain(toolop, ins, op, inside)
+}
+
+// toolpathOpenOffset cuts an open chain, already oriented, compensated by offset.
+func toolpathOpenOffset(toolop *ToolpathOperation, p *path.Path, offset float64) error {
+	op := p.OffsetCapped(offset, false, getEndCap(toolop))
+	op = relieveCorners(toolop, op, getWall(offset, offset < 0))
+	return toolpathOpenChain(toolop, op)
+}
+
+// addEntry travels to above the position at FeedHeight and rapids down to CutHeight.
+func (toolop *ToolpathOperation) addEntry(pos vector2.Vector2) {
+	op := toolop.Operation
+	toolop.Toolpath = append(toolop.Toolpath,
+		ToolpathPoint{pos.X, pos.Y, op.FeedHeight, 0},
+		ToolpathPoint{pos.X, pos.Y, op.CutHeight, 0},
+	)
+}
+
+func (toolop *ToolpathOperation) addPlunge(pos vector2.Vector2, z float64) {
+	toolop.Toolpath = append(toolop.Toolpath, ToolpathPoint{pos.X, pos.Y, z, float64(toolop.Operation.PlungeRate)})
+}
+
+// addRamp descends linearly from z to the pass depth over the distance travelled through points.
+func (toolop *ToolpathOperation) addRamp(from vector2.Vector2, points []vector2.Vector2, rampDist, z float64, pass Pass) {
+	var d float64
+	for _, pt := range points {
+		d += from.DistanceTo(pt)
+		from = pt
+		pz := z - (z-pass.Depth)*math.Min(d/rampDist, 1.0)
+		toolop.Toolpath = append(toolop.Toolpath, ToolpathPoint{pt.X, pt.Y, pz, pass.Feed})
+	}
+}
+
+func (toolop *ToolpathOperation) addCut(pass Pass, points ...vector2.Vector2) {
+	for _, pt := range points {
+		toolop.Toolpath = append(toolop.Toolpath, ToolpathPoint{pt.X, pt.Y, pass.Depth, pass.Feed})
+	}
+}
+
+// addRetract lifts the tool straight up to FeedHeight from the last position.
+func (toolop *ToolpathOperation) addRetract() {
+	if len(toolop.Toolpath) == 0 {
+		return
+	}
+	last := toolop.Toolpath[len(toolop.Toolpath)-1]
+	toolop.Toolpath = append(toolop.Toolpath, ToolpathPoint{last[0], last[1], toolop.Operation.FeedHeight, 0})
+}
+
 func getCompensation(toolop *ToolpathOperation) float64 {
 	// calculate offset
-
-	// get the tool instance
-	t, err := data.GetToolLibrary().GetToolByName(toolop.Operation.Tool)
-	if err != nil {
+	if toolop.Tool == nil {
 		return 0.0
 	}
 
 	// get tool radius
-	tcomp := t.CutDiameter * 0.5
+	tcomp := toolop.Tool.CutDiameter * 0.5
 
 	// calculate offset geometries
 	if toolop.Operation.Offset == "right" {
@@ -87,21 +301,42 @@ func getCompensation(toolop *ToolpathOperation) float64 {
 	return 0.0
 }
 
-func getPaths(toolop *ToolpathOperation) []*path.Path {
-	pths := make([]*path.Path, 0)
-	for _, ins := range toolop.Instance {
-		var pts [][3]float64
-		for _, pt := range ins.Geometry.(nestparser.ChainGeometry).Points {
-			pts = append(pts, [3]float64{pt.X, pt.Y, pt.Bulge})
-		}
-		path := path.NewPathFromBulgePoints(ins.Geometry.(nestparser.ChainGeometry).Closed == 1, pts...)
-		pths = append(pths, path)
+// getEndCap returns how the operation finishes the ends of compensated open chains.
+func getEndCap(toolop *ToolpathOperation) path.EndCap {
+	switch toolop.Operation.EndCap {
+	case "square":
+		return path.EndCapSquare
+	case "round":
+		return path.EndCapRound
+	default:
+		return path.EndCapButt
 	}
-	return pths
 }
 
-func getRampIn(toolop *ToolpathOperation) float64 {
+// getPath builds the path of a chain instance from its exact lines and arcs, densified to within
+// ChainTolerance of them. It returns nil if the instance isn't a chain or has no length.
+func getPath(ins *nestparser.Operation) *path.Path {
+	chain, ok := ins.Geometry.(nestparser.ChainGeometry)
+	if !ok {
+		return nil
+	}
+	var pts [][3]float64
+	for _, pt := range chain.Points {
+		pts = append(pts, [3]float64{pt.X, pt.Y, pt.Bulge})
+	}
+	segs := path.BulgeSegments(chain.Closed == 1, pts)
+	if len(segs) == 0 {
+		return nil
+	}
+	return path.NewPathFromSegments(chain.Closed == 1, segs...).Densify(ChainTolerance)
+}
 
+// getRampIn returns the distance travelled while ramping from one height down to another.
+func getRampIn(toolop *ToolpathOperation, from, to float64) float64 {
+	if toolop.Operation.Ramp <= 0.0 || from <= to {
+		return 0.0
+	}
+	return getRampLength(to, from, toolop.Operation.Ramp*math.Pi/180.0)
 }
 
 // # Helper function to calculate the ramp length given a height difference and angle
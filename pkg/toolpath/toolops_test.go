@@ -0,0 +1,200 @@
+package toolpath
+
+import (
+	"math"
+	"testing"
+
+	"github.com/029614/gcode_lang/internal/data"
+	nestparser "github.com/029614/gcode_lang/internal/parser/nest"
+	"github.com/Anaxarchus/zero-gdscript/pkg/vector2"
+)
+
+const testTolerance = 1e-6
+
+// chainOperation returns an instance of the chain through the points, in part coordinates.
+func chainOperation(name string, closed bool, points ...vector2.Vector2) nestparser.Operation {
+	chain := nestparser.ChainGeometry{}
+	for _, pt := range points {
+		chain.Points = append(chain.Points, nestparser.Point{Vector2: pt})
+	}
+	if closed {
+		chain.Closed = 1
+		chain.Points = append(chain.Points, chain.Points[0])
+	}
+	return nestparser.Operation{Operation: name, Geometry: chain}
+}
+
+// rectChain returns the closed chain around the rectangle, counter-clockwise.
+func rectChain(name string, pos, size vector2.Vector2) nestparser.Operation {
+	end := pos.Add(size)
+	return chainOperation(name, true, pos, vector2.New(end.X, pos.Y), end, vector2.New(pos.X, end.Y))
+}
+
+// testPart returns the part of the size at origin on the sheet, cut out by a PartCut around it, with
+// its other operations, placed as it is when toolpathing.
+func testPart(name string, origin, size vector2.Vector2, ops ...nestparser.Operation) *nestparser.Part {
+	part := &nestparser.Part{ID: name, Name: name, Size: size, Origin: origin}
+	part.Geometry.Chains = append([]nestparser.Operation{rectChain(PartCutOperation, vector2.Zero(), size)}, ops...)
+	placed := part.Placed()
+	for i := range placed.Geometry.Chains {
+		placed.Geometry.Chains[i].Part = placed
+	}
+	for i := range placed.Geometry.Arcs {
+		placed.Geometry.Arcs[i].Part = placed
+	}
+	return placed
+}
+
+// testTool is a quarter inch straight bit that cuts the whole thickness in one pass.
+func testTool() *data.Tool {
+	return &data.Tool{ID: "quarter", Name: "quarter", CutDiameter: 0.25, CutLength: 1, Flutes: 2, FluteType: "compression", Shape: "straight"}
+}
+
+// testCut is a through cut of three quarter inch material in passes of at most 0.3.
+func testCut() *data.Operation {
+	return &data.Operation{
+		Name:         PartCutOperation,
+		Type:         "CUT",
+		Tool:         "quarter",
+		FeedRate:     600,
+		PlungeRate:   100,
+		Offset:       "right",
+		CutDepth:     0,
+		CutHeight:    0.75,
+		FeedHeight:   1,
+		MaxPassDepth: 0.3,
+	}
+}
+
+// testOperation returns the operation cutting the chains of the parts with the named operation.
+func testOperation(op *data.Operation, tool *data.Tool, parts ...*nestparser.Part) *ToolpathOperation {
+	toolop := &ToolpathOperation{Operation: op, Tool: tool, Parts: parts}
+	for _, part := range parts {
+		for i := range part.Geometry.Chains {
+			if part.Geometry.Chains[i].Operation == op.Name {
+				toolop.Instance = append(toolop.Instance, &part.Geometry.Chains[i])
+			}
+		}
+	}
+	return toolop
+}
+
+// checkToolpath checks what every toolpath of the operation must do: start and end at FeedHeight,
+// travel at rapid only above the material, go straight down into it and straight up out of it, cut
+// no deeper than CutDepth, and go no deeper than the operation's pass depth below what it has
+// already cut. It returns the deepest Z reached.
+func checkToolpath(t *testing.T, toolop *ToolpathOperation) float64 {
+	t.Helper()
+	op := toolop.Operation
+	tp := toolop.Toolpath
+	if len(tp) == 0 {
+		t.Fatal("no toolpath")
+	}
+	if first := tp[0]; first[3] != 0 || first[2] != op.FeedHeight {
+		t.Errorf("starts with %v, want a rapid at the feed height %v", first, op.FeedHeight)
+	}
+	if last := tp[len(tp)-1]; last[3] != 0 || last[2] != op.FeedHeight {
+		t.Errorf("ends with %v, want a rapid at the feed height %v", last, op.FeedHeight)
+	}
+
+	maxDepth := getMaxPassDepth(toolop)
+	floor := getPassStart(toolop)
+	for k, pt := range tp {
+		if pt[2] < op.CutDepth-testTolerance {
+			t.Errorf("point %d %v cuts below the cut depth %v", k, pt, op.CutDepth)
+		}
+		if pt[3] == 0 {
+			if pt[2] < op.CutHeight-testTolerance {
+				t.Errorf("point %d %v rapids below the cut height %v", k, pt, op.CutHeight)
+			}
+			// the tool only travels level, or straight up and down
+			if k > 0 && pt[2] != tp[k-1][2] && (pt[0] != tp[k-1][0] || pt[1] != tp[k-1][1]) {
+				t.Errorf("point %d %v rapids across and up or down from %v", k, pt, tp[k-1])
+			}
+			continue
+		}
+		if maxDepth > 0 && pt[2] < floor-maxDepth-testTolerance {
+			t.Errorf("point %d %v goes %v below the %v already cut, deeper than a pass of %v", k, pt, floor-pt[2], floor, maxDepth)
+		}
+		floor = math.Min(floor, pt[2])
+	}
+	return floor
+}
+
+func TestToolpathChain(t *testing.T) {
+	tests := []struct {
+		name string
+		set  func(op *data.Operation)
+	}{
+		{"plunged", func(op *data.Operation) {}},
+		{"ramped", func(op *data.Operation) { op.Ramp = 10 }},
+		{"line leads", func(op *data.Operation) { op.LeadIn, op.LeadOut, op.LeadLength = LeadLine, LeadLine, 0.5 }},
+		{"arc leads", func(op *data.Operation) { op.LeadIn, op.LeadOut, op.LeadLength = LeadArc, LeadArc, 0.5 }},
+		{"ramp leads", func(op *data.Operation) { op.LeadIn, op.LeadOut, op.LeadLength = LeadRamp, LeadRamp, 0.5 }},
+		{"overlap", func(op *data.Operation) { op.Overlap = 0.5 }},
+		{"finish pass", func(op *data.Operation) { op.FinishPassDepth, op.FinishFeedRate = 0.05, 300 }},
+		{"finish allowance", func(op *data.Operation) { op.FinishAllowance, op.FinishFeedRate = 0.02, 300 }},
+		{"conventional", func(op *data.Operation) { op.Direction = DirectionConventional }},
+		{"dog-bones", func(op *data.Operation) { op.CornerRelief = "dogbone" }},
+		{"from the longest edge", func(op *data.Operation) { op.StartPoint = StartLongest }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := testCut()
+			tt.set(op)
+			// a cutout in the middle of the part, cut with the perimeter
+			part := testPart("part", vector2.New(1, 1), vector2.New(20, 10),
+				rectChain(PartCutOperation, vector2.New(8, 3), vector2.New(4, 4)))
+			toolop := testOperation(op, testTool(), part)
+			if err := toolpathChain(toolop); err != nil {
+				t.Fatal(err)
+			}
+			if deepest := checkToolpath(t, toolop); math.Abs(deepest-op.CutDepth) > testTolerance {
+				t.Errorf("cuts down to %v, want the cut depth %v", deepest, op.CutDepth)
+			}
+
+			if len(toolop.Spans) != len(toolop.Instance) {
+				t.Fatalf("%d spans for %d instances", len(toolop.Spans), len(toolop.Instance))
+			}
+			from := 0
+			for _, span := range toolop.Spans {
+				if span.From != from || span.To <= span.From || span.Part != part {
+					t.Errorf("span %+v doesn't follow on from %d", span, from)
+				}
+				from = span.To
+			}
+			if from != len(toolop.Toolpath) {
+				t.Errorf("spans end at %d, want the end of the toolpath at %d", from, len(toolop.Toolpath))
+			}
+		})
+	}
+}
+
+func TestToolpathOpenChain(t *testing.T) {
+	tests := []struct {
+		name   string
+		offset string
+		cap    string
+	}{
+		{"centre line", "", ""},
+		{"right", "right", ""},
+		{"left, round ends", "left", "round"},
+		{"right, square ends", "right", "square"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := testCut()
+			op.Name, op.Offset, op.EndCap = "Groove", tt.offset, tt.cap
+			op.CutDepth = 0.5
+			part := testPart("part", vector2.New(1, 1), vector2.New(20, 10),
+				chainOperation("Groove", false, vector2.New(2, 2), vector2.New(10, 2), vector2.New(10, 8)))
+			toolop := testOperation(op, testTool(), part)
+			if err := toolpathChain(toolop); err != nil {
+				t.Fatal(err)
+			}
+			if deepest := checkToolpath(t, toolop); math.Abs(deepest-op.CutDepth) > testTolerance {
+				t.Errorf("cuts down to %v, want the cut depth %v", deepest, op.CutDepth)
+			}
+		})
+	}
+}
@@ -1,7 +1,11 @@
 package toolpath
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"runtime"
+	"sync"
 
 	"github.com/029614/gcode_lang/internal/data"
 	nestparser "github.com/029614/gcode_lang/internal/parser/nest"
@@ -15,7 +19,24 @@ type Rect2 = rect2.Rect2
 
 type ToolpathSolution []*ToolpathSheet
 
-type ToolpathSheet []*ToolpathOperation
+// ToolpathSheet is the toolpaths of a sheet of the nest, in the order they are cut.
+type ToolpathSheet struct {
+	Number     int
+	Operations []*ToolpathOperation
+	Report     SheetReport
+}
+
+// SheetReport sums up a toolpathed sheet for the operator.
+type SheetReport struct {
+	ToolChanges   int
+	RapidDistance float64 // the distance travelled at rapid
+	// NestedRapidDistance is the distance travelled at rapid cutting the operations in the order they
+	// are nested and retracting fully between features, which the sequenced order saves on.
+	NestedRapidDistance float64
+	// Warnings are the problems that didn't stop the sheet being cut, such as a tool running outside
+	// its chipload range.
+	Warnings []error
+}
 
 type PartCategory int
 
@@ -27,67 +48,305 @@ const (
 	PartCategoryTiny
 )
 
-func Toolpath(nest *nestparser.Nest, data *data.Data) (*ToolpathSolution, error) {
+func (pc PartCategory) String() string {
+	switch pc {
+	case PartCategoryHuge:
+		return "huge"
+	case PartCategoryLarge:
+		return "large"
+	case PartCategoryMedium:
+		return "medium"
+	case PartCategorySmall:
+		return "small"
+	case PartCategoryTiny:
+		return "tiny"
+	default:
+		return "unknown"
+	}
+}
+
+// ToolpathOptions controls how Toolpath works through the sheets of a nest.
+type ToolpathOptions struct {
+	Policy  *SequencePolicy // nil uses DefaultSequencePolicy
+	Workers int             // the number of sheets toolpathed at once; zero uses every CPU
+	// Progress, when set, is called as each sheet finishes with the number finished so far. Calls
+	// come from the workers one at a time, in the order the sheets finish.
+	Progress func(sheet, done, total int)
+}
+
+// SheetError is the failure to toolpath a sheet of the nest.
+type SheetError struct {
+	Sheet int
+	Err   error
+}
+
+func (e *SheetError) Error() string {
+	return fmt.Sprintf("sheet %d: %v", e.Sheet, e.Err)
+}
+
+func (e *SheetError) Unwrap() error {
+	return e.Err
+}
+
+// Toolpath generates the toolpaths of every sheet of the nest, sequenced by policy. A nil policy
+// uses DefaultSequencePolicy.
+func Toolpath(nest *nestparser.Nest, data *data.Data, router *data.Router, policy *SequencePolicy) (*ToolpathSolution, error) {
+	return ToolpathContext(context.Background(), nest, data, router, &ToolpathOptions{Policy: policy})
+}
+
+// ToolpathContext generates the toolpaths of every sheet of the nest on a pool of workers, stopping
+// early when the context is cancelled. The solution holds the sheets that succeeded, in nest order,
+// and the error joins a SheetError for each sheet that failed or was never started.
+func ToolpathContext(ctx context.Context, nest *nestparser.Nest, data *data.Data, router *data.Router, opts *ToolpathOptions) (*ToolpathSolution, error) {
+	if opts == nil {
+		opts = &ToolpathOptions{}
+	}
+	policy := opts.Policy
+	if policy == nil {
+		policy = &DefaultSequencePolicy
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	workers = min(workers, max(len(nest.Sheets), 1))
+
+	// the nest names its material by id or by finish name
+	material, err := data.MaterialLibrary.GetMaterialByID(nest.Material)
+	if err != nil {
+		material, _ = data.MaterialLibrary.GetMaterialByName(nest.Material)
+	}
+
+	sheets := make([]*ToolpathSheet, len(nest.Sheets))
+	errs := make([]error, len(nest.Sheets))
+	jobs := make(chan int)
+	var mu sync.Mutex
+	done := 0
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				sheet := nest.Sheets[i]
+				sheets[i], errs[i] = toolpathSheet(ctx, sheet, data, material, router, policy)
+				if opts.Progress != nil {
+					mu.Lock()
+					done++
+					opts.Progress(sheet.SheetNumber, done, len(nest.Sheets))
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	next := 0
+feed:
+	for ; next < len(nest.Sheets); next++ {
+		select {
+		case jobs <- next:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	for i := next; i < len(nest.Sheets); i++ {
+		errs[i] = ctx.Err()
+	}
+
 	sol := ToolpathSolution{}
-	// Toolpath function
-	for _, sheet := range nest.Sheets {
-		tsh, err := toolpathSheet(sheet, data)
-		sol = append(sol, tsh)
-		if err != nil {
-			return nil, err
+	var failed []error
+	for i, sheet := range nest.Sheets {
+		if errs[i] != nil {
+			failed = append(failed, &SheetError{Sheet: sheet.SheetNumber, Err: errs[i]})
+			continue
 		}
+		sol = append(sol, sheets[i])
 	}
-	return &sol, nil
+	return &sol, errors.Join(failed...)
 }
 
-func toolpathSheet(sheet *nestparser.Sheet, data *data.Data) (*ToolpathSheet, error) {
-	tsh := ToolpathSheet{}
+// toolpathSheet generates the toolpaths of a sheet. Every problem that leaves a cut off the sheet,
+// or cut wrong, is joined into the error, which fails the sheet.
+func toolpathSheet(ctx context.Context, sheet *nestparser.Sheet, data *data.Data, material *data.Material, router *data.Router, policy *SequencePolicy) (*ToolpathSheet, error) {
+	tsh := ToolpathSheet{Number: sheet.SheetNumber}
+	var errs []error
 
 	// Toolpath function
+	opNames := data.OperationLibrary.ListOperationsByName()
 	var opMap = make(map[string][]*nestparser.Operation)
-	for _, opName := range data.OperationLibrary.ListOperationsByName() {
+	for _, opName := range opNames {
 		opMap[opName] = make([]*nestparser.Operation, 0)
 	}
+	add := func(ins *nestparser.Operation) {
+		if _, ok := opMap[ins.Operation]; !ok {
+			opNames = append(opNames, ins.Operation)
+		}
+		opMap[ins.Operation] = append(opMap[ins.Operation], ins)
+	}
 
-	// Compile chains, arcs, and points
+	// Compile chains, arcs, and points, moved to where their parts sit on the sheet
+	var parts []*nestparser.Part
 	for _, part := range sheet.Parts {
-		for _, chain := range part.Geometry.Chains {
-			opMap[chain.Operation] = append(opMap[chain.Operation], &chain)
+		placed := part.Placed()
+		parts = append(parts, placed)
+		for i := range placed.Geometry.Chains {
+			placed.Geometry.Chains[i].Part = placed
+			add(&placed.Geometry.Chains[i])
 		}
-		for _, arc := range part.Geometry.Arcs {
-			opMap[arc.Operation] = append(opMap[arc.Operation], &arc)
+		for i := range placed.Geometry.Arcs {
+			placed.Geometry.Arcs[i].Part = placed
+			add(&placed.Geometry.Arcs[i])
 		}
-		for _, point := range part.Geometry.Points {
-			opMap[point.Operation] = append(opMap[point.Operation], &point)
+		for i := range placed.Geometry.Points {
+			placed.Geometry.Points[i].Part = placed
+			add(&placed.Geometry.Points[i])
 		}
 	}
 
-	for opName, operations := range opMap {
-		dop, _ := data.OperationLibrary.GetOperationByName(opName)
+	// parts cut from other stock are still cut, to the depths of the sheet
+	zref, err := newZReference(material, router, parts)
+	if err != nil {
+		tsh.Report.Warnings = append(tsh.Report.Warnings, err)
+	}
+
+	var tops, skins []*ToolpathOperation
+	for _, opName := range opNames {
+		operations := opMap[opName]
+		if len(operations) == 0 {
+			continue
+		}
+
+		dop, err := data.OperationLibrary.GetOperationByName(opName)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("operation %s: %w", opName, err))
+			continue
+		}
+		tool, err := data.ToolLibrary.GetToolByID(dop.Tool)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("operation %s: %w", opName, err))
+			continue
+		}
+
 		top := ToolpathOperation{
 			Operation: dop,
+			Tool:      tool,
+			Material:  material,
+			Z:         zref,
+			Parts:     parts,
 			Instance:  operations,
 		}
+		if err := zref.resolveOperation(&top); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := zref.checkOperation(&top); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if router != nil && tool != nil {
+			top.Slot = router.FindSpindleSlot(tool.ID)
+		}
+
+		var split, finishes []*ToolpathOperation
+		if dop.Type == "DRILL" {
+			split = selectDrillTools(&top, router, data.ToolLibrary)
+		} else {
+			// onion skinned parts are finished by their skin pass, the rest by the last pass of the cut
+			onion, skin := splitOnion(&top)
+			split, finishes = selectPartTools(&top, router, data.ToolLibrary, true)
+			if onion != nil {
+				roughs, _ := selectPartTools(onion, router, data.ToolLibrary, false)
+				split = append(split, roughs...)
+				skinRoughs, skinFinishes := selectPartTools(skin, router, data.ToolLibrary, true)
+				finishes = append(finishes, skinRoughs...)
+				finishes = append(finishes, skinFinishes...)
+			}
+		}
+		for _, t := range split {
+			if err := applyFeeds(t); err != nil {
+				tsh.Report.Warnings = append(tsh.Report.Warnings, err)
+			}
+			tops = append(tops, t)
+		}
+		for _, t := range finishes {
+			if err := applyFeeds(t); err != nil {
+				tsh.Report.Warnings = append(tsh.Report.Warnings, err)
+			}
+			skins = append(skins, t)
+		}
+	}
+
+	// a toolpath that would cut too deep into the spoilboard is left off the sheet, failing it
+	cut := func(t *ToolpathOperation) {
+		if err := t.toolpath(); err != nil {
+			errs = append(errs, err)
+		}
+		if err := t.Z.checkToolpath(t); err != nil {
+			errs = append(errs, err)
+			return
+		}
+		tsh.Operations = append(tsh.Operations, t)
+	}
+
+	spindle := ""
+	if router != nil {
+		spindle = router.ActiveTool()
+	}
+	sequenced := sequenceSheet(tops, policy, spindle)
+	if err := checkSpindleTools(sequenced, router); err != nil {
+		tsh.Report.Warnings = append(tsh.Report.Warnings, err)
+	}
+	for _, t := range sequenced {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if len(t.Instance) == 0 {
+			continue
+		}
+		if err := checkFeeds(t); err != nil {
+			tsh.Report.Warnings = append(tsh.Report.Warnings, err)
+		}
+		if err := checkChipload(t); err != nil {
+			tsh.Report.Warnings = append(tsh.Report.Warnings, err)
+		}
+		cut(t)
 
-		err := top.toolpath()
+		// corners are cleaned up straight after the tool that left them
+		rest, err := getRestOperation(t, router, data.ToolLibrary)
 		if err != nil {
-			fmt.Println(err)
+			tsh.Report.Warnings = append(tsh.Report.Warnings, err)
+		}
+		if rest != nil {
+			if err := applyFeeds(rest); err != nil {
+				tsh.Report.Warnings = append(tsh.Report.Warnings, err)
+			}
+			cut(rest)
 		}
+	}
 
-		tsh = append(tsh, &top)
+	// skins and finishing passes come off last, once everything else on the sheet has been cut
+	for _, skin := range skins {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		cut(skin)
 	}
 
-	return &tsh, nil
+	tsh.Report.ToolChanges = ToolChanges(tsh.Operations, spindle)
+
+	// travel low between features where nothing loose is in the way
+	planRapids(tsh.Operations, getMaterialTop(tsh.Operations, zref), router)
+	tsh.Report.RapidDistance = RapidDistance(tsh.Operations)
+	tsh.Report.NestedRapidDistance = nestedRapidDistance(tops, skins, router, data.ToolLibrary)
+	return &tsh, errors.Join(errs...)
 }
 
 func (to *ToolpathOperation) toolpath() error {
 	if to.Operation.Type == "CUT" {
-		if to.Instance[0].Geometry.(nestparser.ChainGeometry).Closed == 1 {
-
-			return toolpathChain(to, true)
-		} else {
-			return toolpathChain(to, false)
-		}
+		return toolpathChain(to)
 	} else if to.Operation.Type == "DRILL" {
 		return toolpathArc(to)
 	} else if to.Operation.Type == "POCKET" {
@@ -103,7 +362,7 @@ func getCategory(rect Rect2) PartCategory {
 		return PartCategoryTiny
 	} else if a < 300.0 || rect.Size.X < 6.0 || rect.Size.Y < 6.0 {
 		return PartCategorySmall
-	} else if a < 700.0 || rect.Size.X < 7.25 || rect.Size.Y < 7.25 {
+	} else if a < OnionMinArea || rect.Size.X < OnionMinLength || rect.Size.Y < OnionMinLength {
 		return PartCategoryMedium
 	} else {
 		return PartCategoryLarge
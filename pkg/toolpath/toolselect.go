@@ -0,0 +1,211 @@
+package toolpath
+
+import (
+	"math"
+	"strings"
+
+	"github.com/029614/gcode_lang/internal/data"
+	nestparser "github.com/029614/gcode_lang/internal/parser/nest"
+)
+
+// Flute types of data.Tool.FluteType.
+const (
+	FluteUp          = "up"
+	FluteDown        = "down"
+	FluteCompression = "compression"
+)
+
+// getSpindleTools returns the tools loaded in the router's spindle slots, keyed by slot.
+func getSpindleTools(router *data.Router, tools *data.ToolLibrary) map[int]*data.Tool {
+	res := make(map[int]*data.Tool)
+	if router == nil || tools == nil {
+		return res
+	}
+	for idx := 1; idx <= data.SpindleSlotCount; idx++ {
+		id := string(router.GetSpindleSlot(idx))
+		if id == "" {
+			continue
+		}
+		if tool, err := tools.GetToolByID(id); err == nil {
+			res[idx] = tool
+		}
+	}
+	return res
+}
+
+// DiameterTolerance is the largest difference between the diameters of two tools that still cut the
+// same kerf.
+const DiameterTolerance = 0.0001
+
+// getRoughFlutes returns the flute types to rough a part of the category out with, most preferred
+// first. An upcut clears chips best, or a compression tool when the bottom face of the material is
+// finished too. Small parts are roughed with a compression tool, which doesn't lift them.
+func getRoughFlutes(category PartCategory, material *data.Material) []string {
+	switch {
+	case category == PartCategorySmall || category == PartCategoryTiny:
+		return []string{FluteCompression, FluteUp}
+	case material != nil && isFinishedFace(material.Face2):
+		return []string{FluteCompression, FluteUp}
+	default:
+		return []string{FluteUp, FluteCompression}
+	}
+}
+
+// getFinishFlutes returns the flute types to take the last pass of a part of the category with.
+// Small parts are held down by a downcut as they come free; larger parts are finished by the tool
+// that roughed them.
+func getFinishFlutes(category PartCategory) []string {
+	switch category {
+	case PartCategorySmall, PartCategoryTiny:
+		return []string{FluteDown}
+	default:
+		return nil
+	}
+}
+
+// isDrill reports whether the tool is a drill bit. The tool library doesn't tell drills and
+// router bits apart other than by name.
+func isDrill(tool *data.Tool) bool {
+	return tool.Shape == "point" || strings.Contains(strings.ToUpper(tool.Name), "DRILL")
+}
+
+func isFinishedFace(face string) bool {
+	return face != "" && face != "raw" && face != "none"
+}
+
+// hasFlute reports whether the tool has one of the flute types.
+func hasFlute(tool *data.Tool, flutes []string) bool {
+	for _, flute := range flutes {
+		if tool.FluteType == flute {
+			return true
+		}
+	}
+	return false
+}
+
+// selectTool picks the spindle slot whose tool has the first preferred flute type that can reach the
+// cut depth and is no wider than diameter, favouring the diameter closest to it. Only tools of the
+// same diameter are picked when exact is set. It returns 0 if none fits.
+func selectTool(toolop *ToolpathOperation, loaded map[int]*data.Tool, flutes []string, diameter float64, exact bool) int {
+	depth := toolop.Operation.CutHeight - toolop.Operation.CutDepth
+	for _, flute := range flutes {
+		slot := 0
+		best := math.Inf(1)
+		for idx := 1; idx <= data.SpindleSlotCount; idx++ {
+			tool, ok := loaded[idx]
+			if !ok || isDrill(tool) || tool.FluteType != flute || tool.Shape != "straight" || tool.CutLength < depth {
+				continue
+			}
+			d := diameter - tool.CutDiameter
+			if d < -DiameterTolerance || (exact && d > DiameterTolerance) {
+				continue
+			}
+			if d < best {
+				best = d
+				slot = idx
+			}
+		}
+		if slot != 0 {
+			return slot
+		}
+	}
+	return 0
+}
+
+// selectRoughTool returns the spindle slot of the tool to rough a part of the category out with, or
+// 0 to keep the operation's own tool. The operation's tool is kept when its flute type suits, and
+// otherwise only swapped for a tool of the same diameter, which cuts the same kerf, so the gaps
+// between parts still clear it.
+func selectRoughTool(toolop *ToolpathOperation, loaded map[int]*data.Tool, category PartCategory) int {
+	flutes := getRoughFlutes(category, toolop.Material)
+	if toolop.Tool == nil || hasFlute(toolop.Tool, flutes) {
+		return 0
+	}
+	return selectTool(toolop, loaded, flutes, toolop.Tool.CutDiameter, true)
+}
+
+// partTools is the spindle slots of the tools a part is roughed and finished with. A rough slot of 0
+// keeps the operation's own tool, and a finish slot of 0 leaves every pass to the roughing tool.
+type partTools struct {
+	rough, finish int
+}
+
+// selectPartTools splits a PartCut operation by the spindle tools best suited to each part's size
+// and the material, recording the chosen tool on each operation. Parts are roughed out with an
+// upcut or compression tool; when finish is set, small parts have their last pass split off into
+// finishing operations, cut with a downcut no wider than the roughing tool once everything else on
+// the sheet is. Parts no loaded tool suits stay with the operation's own tool.
+func selectPartTools(toolop *ToolpathOperation, router *data.Router, tools *data.ToolLibrary, finish bool) ([]*ToolpathOperation, []*ToolpathOperation) {
+	if toolop.Operation.Name != PartCutOperation || router == nil {
+		return []*ToolpathOperation{toolop}, nil
+	}
+	loaded := getSpindleTools(router, tools)
+	withSlot := func(slot int) *ToolpathOperation {
+		top := &ToolpathOperation{
+			Operation: toolop.Operation,
+			Tool:      toolop.Tool,
+			Slot:      toolop.Slot,
+			Material:  toolop.Material,
+			Z:         toolop.Z,
+			Parts:     toolop.Parts,
+			Instance:  []*nestparser.Operation{},
+		}
+		if slot != 0 {
+			top.Tool = loaded[slot]
+			top.Slot = slot
+		}
+		return top
+	}
+
+	var roughs, finishes []*ToolpathOperation
+	byTools := make(map[partTools]*ToolpathOperation)
+	finishing := make(map[partTools]*ToolpathOperation)
+	for _, ins := range toolop.Instance {
+		var pt partTools
+		if ins.Part != nil {
+			category := getCategory(getPartRect(ins.Part))
+			pt.rough = selectRoughTool(toolop, loaded, category)
+			rough := toolop.Tool
+			if pt.rough != 0 {
+				rough = loaded[pt.rough]
+			}
+			// a finishing tool wider than the roughing tool would cut into the parts around
+			if flutes := getFinishFlutes(category); finish && len(flutes) > 0 && rough != nil && !hasFlute(rough, flutes) {
+				pt.finish = selectTool(toolop, loaded, flutes, rough.CutDiameter, false)
+			}
+		}
+
+		top, ok := byTools[pt]
+		if !ok {
+			top = withSlot(pt.rough)
+			if pt.finish != 0 {
+				fin := withSlot(pt.finish)
+				if depth, ok := getSplitDepth(top); ok {
+					top.Split = &PassSplit{Depth: depth}
+					fin.Split = &PassSplit{Depth: depth, Finish: true}
+					roughs = append(roughs, top)
+				}
+				finishing[pt] = fin
+				finishes = append(finishes, fin)
+			} else {
+				roughs = append(roughs, top)
+			}
+			byTools[pt] = top
+		}
+		top.Instance = append(top.Instance, ins)
+		if fin, ok := finishing[pt]; ok {
+			fin.Instance = append(fin.Instance, ins)
+		}
+	}
+	return roughs, finishes
+}
+
+// getSplitDepth returns the depth the last pass of the operation starts from, which the finishing
+// tool takes over at. It is false when the cut is a single pass, which the finishing tool takes whole.
+func getSplitDepth(toolop *ToolpathOperation) (float64, bool) {
+	passes := getPasses(toolop)
+	if len(passes) < 2 {
+		return 0, false
+	}
+	return passes[len(passes)-2].Depth, true
+}
@@ -0,0 +1,96 @@
+package toolpath
+
+import (
+	"testing"
+
+	"github.com/029614/gcode_lang/internal/data"
+	"github.com/Anaxarchus/zero-gdscript/pkg/vector2"
+)
+
+// selectTools is a library of straight bits of different diameters and flute types.
+var selectTools = data.ToolLibrary{
+	{ID: "comp38", CutDiameter: 0.375, CutLength: 1, FluteType: FluteCompression, Shape: "straight"},
+	{ID: "up38", CutDiameter: 0.375, CutLength: 1, FluteType: FluteUp, Shape: "straight"},
+	{ID: "down38", CutDiameter: 0.375, CutLength: 1, FluteType: FluteDown, Shape: "straight"},
+	{ID: "up58", CutDiameter: 0.625, CutLength: 1, FluteType: FluteUp, Shape: "straight"},
+	{ID: "down12", CutDiameter: 0.5, CutLength: 1, FluteType: FluteDown, Shape: "straight"},
+	{ID: "down14", CutDiameter: 0.25, CutLength: 1, FluteType: FluteDown, Shape: "straight"},
+}
+
+// spindleSlots loads the tools into the spindle's slots, from the first.
+func spindleSlots(ids ...string) data.RouterSpindleData {
+	var s data.RouterSpindleData
+	slots := []*data.SlotData{&s.One, &s.Two, &s.Three, &s.Four, &s.Five, &s.Six}
+	for i, id := range ids {
+		*slots[i] = data.SlotData(id)
+	}
+	return s
+}
+
+func TestSelectPartTools(t *testing.T) {
+	large, small := vector2.New(30, 20), vector2.New(10, 10)
+	tests := []struct {
+		name     string
+		tool     string
+		size     vector2.Vector2
+		loaded   []string
+		finished bool // the bottom face of the material
+		rough    string
+		finish   string // or empty if the roughing tool cuts every pass
+	}{
+		{"keeps its compression tool", "comp38", large, []string{"up58", "up38", "comp38"}, false, "comp38", ""},
+		{"keeps its upcut on a finished face", "up38", large, []string{"comp38", "up38"}, true, "up38", ""},
+		{"downcut swapped for an upcut as wide", "down38", large, []string{"up58", "up38", "down38"}, false, "up38", ""},
+		{"downcut swapped for a compression tool as wide", "down38", large, []string{"up58", "comp38", "down38"}, false, "comp38", ""},
+		{"never swapped for a wider tool", "down38", large, []string{"up58", "down38"}, false, "down38", ""},
+		{"small part finished with a downcut", "comp38", small, []string{"comp38", "down12", "down14"}, false, "comp38", "down14"},
+		{"small part finished as wide", "comp38", small, []string{"comp38", "down14", "down38"}, false, "comp38", "down38"},
+		{"no downcut narrow enough", "comp38", small, []string{"comp38", "down12"}, false, "comp38", ""},
+		{"small part roughed with a compression tool", "down38", small, []string{"up38", "comp38", "down38"}, false, "comp38", "down38"},
+		{"small part on a downcut it finishes with", "down38", small, []string{"up58", "down38"}, false, "down38", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tool, err := selectTools.GetToolByID(tt.tool)
+			if err != nil {
+				t.Fatal(err)
+			}
+			material := &data.Material{Size: data.MaterialSize{Z: 0.75}}
+			if tt.finished {
+				material.Face2 = "melamine"
+			}
+			router := &data.Router{Spindle: spindleSlots(tt.loaded...)}
+			toolop := testOperation(testCut(), tool, testPart("part", vector2.New(1, 1), tt.size))
+			toolop.Material = material
+			toolop.Slot = router.FindSpindleSlot(tool.ID)
+
+			roughs, finishes := selectPartTools(toolop, router, &selectTools, true)
+			if len(roughs) != 1 || roughs[0].Tool.ID != tt.rough {
+				t.Fatalf("roughed with %v, want %s", toolIDs(roughs), tt.rough)
+			}
+			if roughs[0].Slot != router.FindSpindleSlot(tt.rough) {
+				t.Errorf("roughed from slot %d, want the slot of %s", roughs[0].Slot, tt.rough)
+			}
+			if tt.finish == "" {
+				if len(finishes) != 0 {
+					t.Errorf("finished with %v, want the roughing tool to finish", toolIDs(finishes))
+				}
+				return
+			}
+			if len(finishes) != 1 || finishes[0].Tool.ID != tt.finish {
+				t.Fatalf("finished with %v, want %s", toolIDs(finishes), tt.finish)
+			}
+			if finishes[0].Tool.CutDiameter > roughs[0].Tool.CutDiameter {
+				t.Errorf("finishing tool %s is wider than the roughing tool %s", tt.finish, tt.rough)
+			}
+		})
+	}
+}
+
+func toolIDs(tops []*ToolpathOperation) []string {
+	var ids []string
+	for _, top := range tops {
+		ids = append(ids, top.Tool.ID)
+	}
+	return ids
+}
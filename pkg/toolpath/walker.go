@@ -0,0 +1,170 @@
+package toolpath
+
+import (
+	"math"
+
+	"github.com/Anaxarchus/zero-gdscript/pkg/geometry2d"
+	"github.com/Anaxarchus/zero-gdscript/pkg/vector2"
+)
+
+// chainWalker travels along a chain of points by distance. Closed chains wrap around,
+// open chains turn back at their ends.
+type chainWalker struct {
+	points []vector2.Vector2
+	closed bool
+	index  int // the vertex most recently passed
+	step   int // 1 when travelling forward, -1 when travelling backward
+	pos    vector2.Vector2
+	dist   float64 // distance of pos from the first point, measured forward along the chain
+	total  float64
+}
+
+// newChainWalker returns a walker positioned on the first point, or nil if the chain has no length.
+func newChainWalker(points []vector2.Vector2, closed bool) *chainWalker {
+	var pts []vector2.Vector2
+	for _, pt := range points {
+		if len(pts) == 0 || !pts[len(pts)-1].IsEqualApprox(pt) {
+			pts = append(pts, pt)
+		}
+	}
+	// closed chains repeat their first point, which the walker handles by wrapping
+	if closed && len(pts) > 1 && pts[0].IsEqualApprox(pts[len(pts)-1]) {
+		pts = pts[:len(pts)-1]
+	}
+	if len(pts) < 2 {
+		return nil
+	}
+
+	w := &chainWalker{
+		points: pts,
+		closed: closed,
+		step:   1,
+		pos:    pts[0],
+	}
+	for i := 0; i < w.segmentCount(); i++ {
+		w.total += w.segmentLength(i)
+	}
+	return w
+}
+
+// length returns the length of the chain, including the closing segment of closed chains.
+func (w *chainWalker) length() float64 {
+	return w.total
+}
+
+func (w *chainWalker) segmentCount() int {
+	if w.closed {
+		return len(w.points)
+	}
+	return len(w.points) - 1
+}
+
+// segment returns the end points of the i-th segment, in the forward direction.
+func (w *chainWalker) segment(i int) (vector2.Vector2, vector2.Vector2) {
+	return w.points[i], w.points[(i+1)%len(w.points)]
+}
+
+func (w *chainWalker) segmentLength(i int) float64 {
+	a, b := w.segment(i)
+	return a.DistanceTo(b)
+}
+
+func (w *chainWalker) nextIndex() int {
+	n := w.index + w.step
+	if w.closed {
+		return (n + len(w.points)) % len(w.points)
+	}
+	if n < 0 || n >= len(w.points) {
+		w.step = -w.step
+		n = w.index + w.step
+	}
+	return n
+}
+
+// walk advances the walker by distance and returns every vertex passed, ending with the new position.
+func (w *chainWalker) walk(distance float64) []vector2.Vector2 {
+	var res []vector2.Vector2
+	for distance > 1e-9 {
+		n := w.nextIndex()
+		target := w.points[n]
+		seg := w.pos.DistanceTo(target)
+		if seg <= distance {
+			res = append(res, target)
+			w.advance(seg)
+			w.pos = target
+			w.index = n
+			distance -= seg
+			continue
+		}
+		w.pos = w.pos.Add(w.pos.DirectionTo(target).Mulf(distance))
+		w.advance(distance)
+		res = append(res, w.pos)
+		break
+	}
+	return res
+}
+
+func (w *chainWalker) advance(d float64) {
+	w.dist += d * float64(w.step)
+	if w.closed {
+		w.dist = math.Mod(w.dist+w.total, w.total)
+	}
+}
+
+// toStart walks an open chain back to its first point and returns the vertices passed.
+func (w *chainWalker) toStart() []vector2.Vector2 {
+	var res []vector2.Vector2
+	i := w.index
+	if w.step < 0 || w.pos.IsEqualApprox(w.points[i]) {
+		i--
+	}
+	for ; i >= 0; i-- {
+		res = append(res, w.points[i])
+	}
+	w.index = 0
+	w.step = 1
+	w.pos = w.points[0]
+	w.dist = 0
+	return res
+}
+
+// reset puts the walker back on the first point of the chain, travelling forward.
+func (w *chainWalker) reset() {
+	w.index = 0
+	w.step = 1
+	w.pos = w.points[0]
+	w.dist = 0
+}
+
+// positionAt returns the point at distance d along the chain from its first point.
+func (w *chainWalker) positionAt(d float64) vector2.Vector2 {
+	if w.closed {
+		d = math.Mod(math.Mod(d, w.total)+w.total, w.total)
+	}
+	for i := 0; i < w.segmentCount(); i++ {
+		a, b := w.segment(i)
+		l := a.DistanceTo(b)
+		if d <= l {
+			return a.Add(a.DirectionTo(b).Mulf(d))
+		}
+		d -= l
+	}
+	return w.points[len(w.points)-1]
+}
+
+// project returns the distance along the chain of the point on it nearest to pt.
+func (w *chainWalker) project(pt vector2.Vector2) float64 {
+	best := math.Inf(1)
+	res := 0.0
+	var d float64
+	for i := 0; i < w.segmentCount(); i++ {
+		a, b := w.segment(i)
+		n := geometry2d.GetClosestPointToSegment(pt, [2]vector2.Vector2{a, b})
+		if dd := pt.DistanceSquaredTo(n); dd < best {
+			best = dd
+			res = d + a.DistanceTo(n)
+		}
+		d += a.DistanceTo(b)
+	}
+	return res
+}
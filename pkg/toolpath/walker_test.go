@@ -0,0 +1,127 @@
+package toolpath
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Anaxarchus/zero-gdscript/pkg/vector2"
+)
+
+// squarePoints are the corners of the square of side 2 from the origin, counter-clockwise.
+var squarePoints = []vector2.Vector2{vector2.New(0, 0), vector2.New(2, 0), vector2.New(2, 2), vector2.New(0, 2)}
+
+func near(a, b vector2.Vector2) bool {
+	return a.DistanceTo(b) < testTolerance
+}
+
+func TestChainWalkerWalk(t *testing.T) {
+	tests := []struct {
+		name   string
+		points []vector2.Vector2
+		closed bool
+		walks  []float64
+		passed []vector2.Vector2 // the points passed by the last walk
+		dist   float64           // the distance along the chain walked to
+	}{
+		{"along an edge", squarePoints, true, []float64{1}, []vector2.Vector2{vector2.New(1, 0)}, 1},
+		{"round a corner", squarePoints, true, []float64{3}, []vector2.Vector2{vector2.New(2, 0), vector2.New(2, 1)}, 3},
+		{"past the start", squarePoints, true, []float64{7, 2}, []vector2.Vector2{vector2.New(0, 0), vector2.New(1, 0)}, 1},
+		{"closing point repeated", append(squarePoints, squarePoints[0]), true, []float64{8}, []vector2.Vector2{vector2.New(2, 0), vector2.New(2, 2), vector2.New(0, 2), vector2.New(0, 0)}, 0},
+		{"open, to its end", squarePoints, false, []float64{6}, []vector2.Vector2{vector2.New(2, 0), vector2.New(2, 2), vector2.New(0, 2)}, 6},
+		{"open, turned back", squarePoints, false, []float64{6, 3}, []vector2.Vector2{vector2.New(2, 2), vector2.New(2, 1)}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newChainWalker(tt.points, tt.closed)
+			var passed []vector2.Vector2
+			for _, d := range tt.walks {
+				passed = w.walk(d)
+			}
+			if len(passed) != len(tt.passed) {
+				t.Fatalf("passed %v, want %v", passed, tt.passed)
+			}
+			for i := range passed {
+				if !near(passed[i], tt.passed[i]) {
+					t.Errorf("passed %v, want %v", passed, tt.passed)
+					break
+				}
+			}
+			if math.Abs(w.dist-tt.dist) > testTolerance {
+				t.Errorf("walked to %v, want %v", w.dist, tt.dist)
+			}
+			if !near(w.pos, w.positionAt(w.dist)) {
+				t.Errorf("at %v, but %v along the chain is %v", w.pos, w.dist, w.positionAt(w.dist))
+			}
+		})
+	}
+}
+
+func TestChainWalker(t *testing.T) {
+	tests := []struct {
+		name   string
+		points []vector2.Vector2
+		closed bool
+		length float64
+	}{
+		{"closed", squarePoints, true, 8},
+		{"open", squarePoints, false, 6},
+		{"doubled points", []vector2.Vector2{vector2.New(0, 0), vector2.New(0, 0), vector2.New(2, 0), vector2.New(2, 2)}, false, 4},
+		{"no length", []vector2.Vector2{vector2.New(1, 1), vector2.New(1, 1)}, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newChainWalker(tt.points, tt.closed)
+			if tt.length == 0 {
+				if w != nil {
+					t.Errorf("walker over a chain of no length")
+				}
+				return
+			}
+			if math.Abs(w.length()-tt.length) > testTolerance {
+				t.Errorf("length = %v, want %v", w.length(), tt.length)
+			}
+			// positions project back to the distance they are at
+			for d := 0.25; d < tt.length; d += 0.5 {
+				if got := w.project(w.positionAt(d)); math.Abs(got-d) > testTolerance {
+					t.Errorf("project(positionAt(%v)) = %v", d, got)
+				}
+			}
+		})
+	}
+}
+
+func TestChainWalkerToStart(t *testing.T) {
+	w := newChainWalker(squarePoints, false)
+	w.walk(5)
+	back := w.toStart()
+	want := []vector2.Vector2{vector2.New(2, 2), vector2.New(2, 0), vector2.New(0, 0)}
+	if len(back) != len(want) {
+		t.Fatalf("went back through %v, want %v", back, want)
+	}
+	for i := range back {
+		if !near(back[i], want[i]) {
+			t.Errorf("went back through %v, want %v", back, want)
+			break
+		}
+	}
+	if w.dist != 0 || w.step != 1 || !near(w.pos, squarePoints[0]) {
+		t.Errorf("walker at %v, %v along, stepping %d, want it back on the first point", w.pos, w.dist, w.step)
+	}
+}
+
+func TestChainWalkerStartingAt(t *testing.T) {
+	w := newChainWalker(squarePoints, true)
+	for _, d := range []float64{0, 1, 2, 3.5, 7.9} {
+		s := w.startingAt(d)
+		if !near(s.pos, w.positionAt(d)) {
+			t.Errorf("startingAt(%v) starts at %v, want %v", d, s.pos, w.positionAt(d))
+		}
+		if math.Abs(s.length()-w.length()) > testTolerance {
+			t.Errorf("startingAt(%v) is %v long, want %v", d, s.length(), w.length())
+		}
+		// the same way round
+		if got, want := s.directionAt(0), w.directionAt(d); !near(got, want) {
+			t.Errorf("startingAt(%v) heads %v, want %v", d, got, want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package toolpath
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/029614/gcode_lang/internal/data"
+	nestparser "github.com/029614/gcode_lang/internal/parser/nest"
+)
+
+// ZeroTable and ZeroTop are the references Z is measured from: the table surface, or the top of the
+// material.
+const (
+	ZeroTable = "table"
+	ZeroTop   = "top"
+)
+
+// ThicknessTolerance is the largest difference between the thickness of a part and of its material
+// that isn't reported.
+const ThicknessTolerance = 0.005
+
+// ZReference resolves the heights and depths of operations to absolute Z, measured up from the table
+// surface, which toolpaths are planned in, and converts them to the Z of the machine on output.
+type ZReference struct {
+	Thickness   float64 // the thickness of the material, the Z of its top
+	Penetration float64 // the deepest cut allowed below the table, into the spoilboard
+	Zero        string  // where the machine's Z zero is set, ZeroTable or ZeroTop
+	NegativeUp  bool    // whether the machine's Z axis is negative upwards
+}
+
+// newZReference returns the Z reference of a sheet of the material cut on the router. The thickness
+// comes from the material, or else from the parts. The error reports each part whose thickness
+// differs from it.
+func newZReference(material *data.Material, router *data.Router, parts []*nestparser.Part) (ZReference, error) {
+	zref := ZReference{}
+	if router != nil {
+		zref.Penetration = math.Max(router.SpoilboardPenetration, 0)
+		zref.Zero = router.ZZero
+		zref.NegativeUp = router.ZNegativeUp
+	}
+	if material != nil {
+		zref.Thickness = material.Thickness()
+	}
+
+	var errs []error
+	for _, part := range parts {
+		if part.Thickness <= 0 {
+			continue
+		}
+		if zref.Thickness <= 0 {
+			zref.Thickness = part.Thickness
+		} else if math.Abs(part.Thickness-zref.Thickness) > ThicknessTolerance {
+			errs = append(errs, fmt.Errorf("part %s: thickness %.4f differs from the %.4f of the material",
+				part.Name, part.Thickness, zref.Thickness))
+		}
+	}
+	return zref, errors.Join(errs...)
+}
+
+// Floor returns the lowest Z any move may reach.
+func (zref ZReference) Floor() float64 {
+	return -zref.Penetration
+}
+
+// Machine converts an absolute Z to the Z of the machine.
+func (zref ZReference) Machine(z float64) float64 {
+	if zref.Zero == ZeroTop {
+		z -= zref.Thickness
+	}
+	if zref.NegativeUp && z != 0 {
+		z = -z
+	}
+	return z
+}
+
+// resolveOperation gives the operation absolute heights and depths. Operations measured from the top
+// of the material are copied, since operations split by tool share them.
+func (zref ZReference) resolveOperation(toolop *ToolpathOperation) error {
+	op := toolop.Operation
+	switch op.ZReference {
+	case "", ZeroTable:
+		return nil
+	case ZeroTop:
+	default:
+		return fmt.Errorf("operation %s: z reference %q not recognized", op.Name, op.ZReference)
+	}
+	if zref.Thickness <= 0 {
+		return fmt.Errorf("operation %s: is measured from the top of the material, whose thickness isn't known", op.Name)
+	}
+
+	resolved := *op
+	resolved.ZReference = ZeroTable
+	resolved.CutDepth += zref.Thickness
+	resolved.CutHeight += zref.Thickness
+	resolved.FeedHeight += zref.Thickness
+	if resolved.DrillDepth != 0 {
+		// measured from the top, the depth is always relative to where drilling starts
+		resolved.DrillDepth -= resolved.DrillHeight
+	}
+	resolved.DrillHeight += zref.Thickness
+	toolop.Operation = &resolved
+	return nil
+}
+
+// checkOperation refuses an operation set to cut deeper into the spoilboard than is allowed.
+func (zref ZReference) checkOperation(toolop *ToolpathOperation) error {
+	op := toolop.Operation
+	depth := op.CutDepth
+	if op.Type == "DRILL" {
+		depth = getDrillDepth(op)
+	}
+	if depth < zref.Floor()-1e-9 {
+		return fmt.Errorf("operation %s: cuts %.4f below the table, deeper than the %.4f allowed into the spoilboard",
+			op.Name, -depth, zref.Penetration)
+	}
+	return nil
+}
+
+// checkToolpath refuses a toolpath with a move deeper into the spoilboard than is allowed, reporting
+// each such move.
+func (zref ZReference) checkToolpath(toolop *ToolpathOperation) error {
+	var errs []error
+	for _, pt := range toolop.Toolpath {
+		if pt[2] < zref.Floor()-1e-9 {
+			errs = append(errs, fmt.Errorf("operation %s: move to (%.4f, %.4f) cuts %.4f below the table, deeper than the %.4f allowed into the spoilboard",
+				toolop.Operation.Name, pt[0], pt[1], -pt[2], zref.Penetration))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,184 @@
+package toolpath
+
+import (
+	"math"
+	"testing"
+
+	"github.com/029614/gcode_lang/internal/data"
+	nestparser "github.com/029614/gcode_lang/internal/parser/nest"
+)
+
+func TestZReferenceMachine(t *testing.T) {
+	tests := []struct {
+		name       string
+		zero       string
+		negativeUp bool
+		z, want    float64
+	}{
+		{"table zero", ZeroTable, false, 1, 1},
+		{"table zero, below the table", ZeroTable, false, -0.02, -0.02},
+		{"unset zero", "", false, 0.5, 0.5},
+		{"top zero", ZeroTop, false, 1, 0.25},
+		{"top zero, on the table", ZeroTop, false, 0, -0.75},
+		{"top zero, on the top", ZeroTop, false, 0.75, 0},
+		{"table zero, negative up", ZeroTable, true, 1, -1},
+		{"top zero, negative up", ZeroTop, true, 0, 0.75},
+		{"negative up, on the zero", ZeroTop, true, 0.75, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zref := ZReference{Thickness: 0.75, Zero: tt.zero, NegativeUp: tt.negativeUp}
+			got := zref.Machine(tt.z)
+			if math.Abs(got-tt.want) > testTolerance {
+				t.Errorf("Machine(%v) = %v, want %v", tt.z, got, tt.want)
+			}
+			// a zero isn't written as -0
+			if got == 0 && math.Signbit(got) {
+				t.Errorf("Machine(%v) = -0", tt.z)
+			}
+		})
+	}
+}
+
+func TestNewZReference(t *testing.T) {
+	material := &data.Material{Size: data.MaterialSize{X: 97, Y: 49, Z: 0.75}}
+	router := &data.Router{ZZero: ZeroTop, ZNegativeUp: true, SpoilboardPenetration: 0.02}
+	tests := []struct {
+		name        string
+		material    *data.Material
+		router      *data.Router
+		thicknesses []float64
+		thickness   float64
+		penetration float64
+		mismatched  bool
+	}{
+		{"from the material", material, router, []float64{0.75, 0}, 0.75, 0.02, false},
+		{"within tolerance", material, router, []float64{0.753}, 0.75, 0.02, false},
+		{"a part differs", material, router, []float64{0.75, 0.5}, 0.75, 0.02, true},
+		{"from the parts", nil, router, []float64{0, 0.5}, 0.5, 0.02, false},
+		{"parts differ", nil, router, []float64{0.5, 0.75}, 0.5, 0.02, true},
+		{"unknown", nil, nil, nil, 0, 0, false},
+		{"negative penetration", material, &data.Router{SpoilboardPenetration: -1}, nil, 0.75, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var parts []*nestparser.Part
+			for _, thickness := range tt.thicknesses {
+				parts = append(parts, &nestparser.Part{Name: "part", Thickness: thickness})
+			}
+			zref, err := newZReference(tt.material, tt.router, parts)
+			if (err != nil) != tt.mismatched {
+				t.Errorf("error %v, want a mismatch %v", err, tt.mismatched)
+			}
+			if zref.Thickness != tt.thickness || zref.Penetration != tt.penetration {
+				t.Errorf("thickness %v and penetration %v, want %v and %v", zref.Thickness, zref.Penetration, tt.thickness, tt.penetration)
+			}
+			if tt.router != nil && (zref.Zero != tt.router.ZZero || zref.NegativeUp != tt.router.ZNegativeUp) {
+				t.Errorf("zero %q, negative up %v, want the router's", zref.Zero, zref.NegativeUp)
+			}
+		})
+	}
+}
+
+func TestResolveOperation(t *testing.T) {
+	tests := []struct {
+		name      string
+		reference string
+		thickness float64
+		op        data.Operation
+		want      data.Operation // the heights and depths resolved
+		err       bool
+	}{
+		{"from the table", ZeroTable, 0.75,
+			data.Operation{CutDepth: 0.5, CutHeight: 1, FeedHeight: 1.5},
+			data.Operation{CutDepth: 0.5, CutHeight: 1, FeedHeight: 1.5}, false},
+		{"unset", "", 0.75,
+			data.Operation{CutDepth: 0.5, CutHeight: 1, FeedHeight: 1.5},
+			data.Operation{CutDepth: 0.5, CutHeight: 1, FeedHeight: 1.5}, false},
+		{"from the top", ZeroTop, 0.75,
+			data.Operation{CutDepth: -0.25, CutHeight: 0.25, FeedHeight: 0.5},
+			data.Operation{CutDepth: 0.5, CutHeight: 1, FeedHeight: 1.25, DrillHeight: 0.75}, false},
+		{"through the sheet", ZeroTop, 0.75,
+			data.Operation{CutDepth: -0.77, CutHeight: 0.25, FeedHeight: 0.5},
+			data.Operation{CutDepth: -0.02, CutHeight: 1, FeedHeight: 1.25, DrillHeight: 0.75}, false},
+		{"drilled from the top", ZeroTop, 0.75,
+			data.Operation{Type: "DRILL", DrillHeight: 0.1, DrillDepth: -0.5},
+			data.Operation{Type: "DRILL", CutDepth: 0.75, CutHeight: 0.75, FeedHeight: 0.75, DrillHeight: 0.85, DrillDepth: -0.6}, false},
+		{"drilled at the top", ZeroTop, 0.75,
+			data.Operation{Type: "DRILL", DrillDepth: -0.5},
+			data.Operation{Type: "DRILL", CutDepth: 0.75, CutHeight: 0.75, FeedHeight: 0.75, DrillHeight: 0.75, DrillDepth: -0.5}, false},
+		{"no thickness", ZeroTop, 0, data.Operation{CutDepth: -0.25}, data.Operation{}, true},
+		{"not recognized", "bottom", 0.75, data.Operation{CutDepth: -0.25}, data.Operation{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := tt.op
+			op.Name, op.ZReference = "op", tt.reference
+			toolop := &ToolpathOperation{Operation: &op}
+			err := ZReference{Thickness: tt.thickness}.resolveOperation(toolop)
+			if tt.err {
+				if err == nil {
+					t.Error("resolved, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := toolop.Operation
+			if got.ZReference != ZeroTable && got.ZReference != "" {
+				t.Errorf("resolved from %q, want the table", got.ZReference)
+			}
+			for _, z := range []struct {
+				name      string
+				got, want float64
+			}{
+				{"cut depth", got.CutDepth, tt.want.CutDepth},
+				{"cut height", got.CutHeight, tt.want.CutHeight},
+				{"feed height", got.FeedHeight, tt.want.FeedHeight},
+				{"drill height", got.DrillHeight, tt.want.DrillHeight},
+				{"drill depth", got.DrillDepth, tt.want.DrillDepth},
+			} {
+				if math.Abs(z.got-z.want) > testTolerance {
+					t.Errorf("%s %v, want %v", z.name, z.got, z.want)
+				}
+			}
+			// operations split by tool share the one resolved
+			if tt.reference == ZeroTop && op.CutDepth != tt.op.CutDepth {
+				t.Errorf("resolved in place, want a copy")
+			}
+		})
+	}
+}
+
+func TestCheckZReference(t *testing.T) {
+	tests := []struct {
+		name        string
+		op          data.Operation
+		toolpath    []ToolpathPoint
+		penetration float64
+		err         bool
+	}{
+		{"above the table", data.Operation{CutDepth: 0.1}, []ToolpathPoint{{0, 0, 0.1, 600}}, 0, false},
+		{"on the table", data.Operation{CutDepth: 0}, []ToolpathPoint{{0, 0, 0, 600}}, 0, false},
+		{"within the penetration", data.Operation{CutDepth: -0.02}, []ToolpathPoint{{0, 0, -0.02, 600}}, 0.02, false},
+		{"into the spoilboard", data.Operation{CutDepth: -0.02}, []ToolpathPoint{{0, 0, -0.02, 600}}, 0, true},
+		{"too deep", data.Operation{CutDepth: -0.05}, []ToolpathPoint{{0, 0, -0.05, 600}}, 0.02, true},
+		{"drilled within", data.Operation{Type: "DRILL", DrillHeight: 0.75, DrillDepth: -0.76}, []ToolpathPoint{{0, 0, -0.01, 100}}, 0.02, false},
+		{"drilled too deep", data.Operation{Type: "DRILL", DrillDepth: -0.05}, []ToolpathPoint{{0, 0, -0.05, 100}}, 0.02, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := tt.op
+			op.Name = "op"
+			toolop := &ToolpathOperation{Operation: &op, Toolpath: tt.toolpath}
+			zref := ZReference{Thickness: 0.75, Penetration: tt.penetration}
+			if err := zref.checkOperation(toolop); (err != nil) != tt.err {
+				t.Errorf("checkOperation = %v, want an error %v", err, tt.err)
+			}
+			if err := zref.checkToolpath(toolop); (err != nil) != tt.err {
+				t.Errorf("checkToolpath = %v, want an error %v", err, tt.err)
+			}
+		})
+	}
+}